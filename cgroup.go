@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// cgroupConfig contains cgroup v2 limits of task, string values are written
+// to corresponding files as is, so "max" means no limit
+type cgroupConfig struct {
+	CPUMax     string `json:"cpuMax,omitempty"`     // "quota period" in us, like "50000 100000"
+	MemoryMax  string `json:"memoryMax,omitempty"`  // bytes, K/M/G suffixes allowed
+	MemoryHigh string `json:"memoryHigh,omitempty"` // throttling limit, format as memoryMax
+	PidsMax    int    `json:"pidsMax,omitempty"`
+	IOWeight   int    `json:"ioWeight,omitempty"` // 1-10000, default 100
+}
+
+// usesCgroup returns true if processes of task are placed into own cgroup
+func (t *Task) usesCgroup() bool {
+	return t.KillMode == killModeCgroup || nil != t.Cgroup
+}
+
+// cgroupParent returns configured parent of all task cgroups
+func cgroupParent() string {
+	if parent := aConfig.Load().CgroupParent; parent != "" {
+		return parent
+	}
+	return defaultCgroupParent
+}
+
+// checkCgroup validates cgroup limits of task
+func (t *Task) checkCgroup() error {
+	c := t.Cgroup
+	if nil == c {
+		return nil
+	}
+
+	if c.CPUMax != "" {
+		fields := strings.Fields(c.CPUMax)
+		if len(fields) < 1 || len(fields) > 2 {
+			return fmt.Errorf("invalid cpuMax \"%s\"", c.CPUMax)
+		}
+		if _, err := strconv.ParseUint(fields[0], 10, 64); nil != err && fields[0] != "max" {
+			return fmt.Errorf("invalid cpuMax quota \"%s\"", fields[0])
+		}
+		if len(fields) == 2 {
+			if _, err := strconv.ParseUint(fields[1], 10, 64); nil != err {
+				return fmt.Errorf("invalid cpuMax period \"%s\"", fields[1])
+			}
+		}
+	}
+	if c.PidsMax < 0 {
+		return errors.New("pidsMax can't be negative")
+	}
+	if c.IOWeight != 0 && (c.IOWeight < 1 || c.IOWeight > 10000) {
+		return errors.New("ioWeight should be in range 1-10000")
+	}
+
+	return cgroupSupported()
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+)
+
+const (
+	defaultCgroupParent = ""
+)
+
+var (
+	errCgroupUnsupported = errors.New("cgroups are supported only on linux")
+)
+
+func cgroupSupported() error {
+	return errCgroupUnsupported
+}
+
+func (t *Task) startInCgroup(cmd *exec.Cmd, slot int) error {
+	return errCgroupUnsupported
+}
+
+func (t *Task) signalCgroup(slot int, sig os.Signal) error {
+	return errCgroupUnsupported
+}
+
+func (t *Task) cleanCgroup(slot int, out io.Writer, kill bool) {
+}
+
+func (t *Task) removeCgroup() {
+}
+
+func (t *Task) cgroupUsage() (float64, uint64) {
+	return 0, 0
+}
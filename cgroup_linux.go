@@ -0,0 +1,318 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	cgroupMount         = "/sys/fs/cgroup"
+	defaultCgroupParent = cgroupMount + "/minisv"
+)
+
+// cgroupSupported checks that unified (v2) cgroup hierarchy is mounted
+func cgroupSupported() error {
+	_, err := os.Stat(filepath.Join(cgroupMount, "cgroup.controllers"))
+	if nil != err {
+		return fmt.Errorf("cgroup v2 is not available: %w", err)
+	}
+	return nil
+}
+
+var (
+	cgroupControllers = []string{"cpu", "memory", "pids", "io"}
+	cgroupInitLock    sync.Mutex
+)
+
+// cgroupTaskDir returns cgroup of task, which contains cgroups of slots
+func (t *Task) cgroupTaskDir() string {
+	return filepath.Join(cgroupParent(), t.name)
+}
+
+// cgroupDir returns cgroup of process in slot of task
+func (t *Task) cgroupDir(slot int) string {
+	return filepath.Join(t.cgroupTaskDir(), strconv.Itoa(slot))
+}
+
+// enableControllers enables available controllers for children of every
+// cgroup from mount point to dir; controllers can't be enabled in cgroup
+// with processes, so if minisv is in root cgroup (usual in container)
+// it moves itself into leaf "init" cgroup
+func enableControllers(dir string) error {
+	cgroupInitLock.Lock()
+	defer cgroupInitLock.Unlock()
+
+	rel, err := filepath.Rel(cgroupMount, dir)
+	if nil != err || strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("cgroup %s is outside of %s", dir, cgroupMount)
+	}
+
+	current := cgroupMount
+	parts := strings.Split(rel, string(filepath.Separator))
+	for i := 0; i <= len(parts); i++ {
+		if i > 0 {
+			current = filepath.Join(current, parts[i-1])
+			err = os.Mkdir(current, 0755)
+			if nil != err && !os.IsExist(err) {
+				return err
+			}
+		}
+
+		available, err := os.ReadFile(filepath.Join(current, "cgroup.controllers"))
+		if nil != err {
+			return err
+		}
+		enabled, err := os.ReadFile(filepath.Join(current, "cgroup.subtree_control"))
+		if nil != err {
+			return err
+		}
+
+		for _, c := range cgroupControllers {
+			if !hasWord(string(available), c) || hasWord(string(enabled), c) {
+				continue
+			}
+			err = writeCgroupFile(current, "cgroup.subtree_control", "+"+c)
+			if errors.Is(err, syscall.EBUSY) && current == cgroupMount {
+				if err = moveSelfToLeaf(); nil == err {
+					err = writeCgroupFile(current, "cgroup.subtree_control", "+"+c)
+				}
+			}
+			if nil != err {
+				return fmt.Errorf("unable to enable %s controller in %s: %w",
+					c, current, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// moveSelfToLeaf moves minisv process from root cgroup into "init" one
+func moveSelfToLeaf() error {
+	leaf := filepath.Join(cgroupMount, "init")
+	err := os.Mkdir(leaf, 0755)
+	if nil != err && !os.IsExist(err) {
+		return err
+	}
+	log.Println("Moving minisv into cgroup ", leaf)
+	return writeCgroupFile(leaf, "cgroup.procs", strconv.Itoa(os.Getpid()))
+}
+
+func hasWord(list, word string) bool {
+	for _, w := range strings.Fields(list) {
+		if w == word {
+			return true
+		}
+	}
+	return false
+}
+
+func writeCgroupFile(dir, name, value string) error {
+	return os.WriteFile(filepath.Join(dir, name), []byte(value), 0)
+}
+
+// applyCgroupLimits writes limits of task into cgroup
+func (t *Task) applyCgroupLimits(dir string) error {
+	c := t.Cgroup
+	if nil == c {
+		return nil
+	}
+
+	limits := [][2]string{
+		{"cpu.max", c.CPUMax},
+		{"memory.max", c.MemoryMax},
+		{"memory.high", c.MemoryHigh},
+	}
+	if c.PidsMax > 0 {
+		limits = append(limits, [2]string{"pids.max", strconv.Itoa(c.PidsMax)})
+	}
+	if c.IOWeight > 0 {
+		limits = append(limits, [2]string{"io.weight", strconv.Itoa(c.IOWeight)})
+	}
+
+	for _, limit := range limits {
+		if limit[1] == "" {
+			continue
+		}
+		err := writeCgroupFile(dir, limit[0], limit[1])
+		if nil != err {
+			return fmt.Errorf("unable to set %s: %w", limit[0], err)
+		}
+	}
+
+	return nil
+}
+
+// startInCgroup creates cgroup for slot and starts command directly in it,
+// so even first forks of process can't escape
+func (t *Task) startInCgroup(cmd *exec.Cmd, slot int) (err error) {
+	// controllers are required only for limits, without them cgroup
+	// is still usable for kill mode and cpu accounting
+	err = enableControllers(t.cgroupTaskDir())
+	if nil != err && nil != t.Cgroup {
+		return err
+	}
+
+	dir := t.cgroupDir(slot)
+	err = os.MkdirAll(dir, 0755)
+	if nil != err {
+		return fmt.Errorf("unable to create cgroup: %w", err)
+	}
+	defer func() {
+		// cgroup of process which wasn't started is empty
+		if nil != err {
+			_ = syscall.Rmdir(dir)
+		}
+	}()
+
+	err = t.applyCgroupLimits(dir)
+	if nil != err {
+		return err
+	}
+
+	f, err := os.Open(dir)
+	if nil != err {
+		return fmt.Errorf("unable to open cgroup: %w", err)
+	}
+	defer f.Close()
+
+	if nil == cmd.SysProcAttr {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(f.Fd())
+
+	return startProcess(cmd)
+}
+
+// cgroupPids returns list of processes in cgroup
+func cgroupPids(dir string) ([]int, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup.procs"))
+	if nil != err {
+		return nil, err
+	}
+
+	pids := []int{}
+	for _, line := range strings.Fields(string(data)) {
+		pid, err := strconv.Atoi(line)
+		if nil == err {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+// signalCgroup sends signal to all processes of cgroup
+func (t *Task) signalCgroup(slot int, sig os.Signal) error {
+	dir := t.cgroupDir(slot)
+
+	// cgroup.kill is available since linux 5.14 and is race-free
+	if sig == syscall.SIGKILL {
+		err := os.WriteFile(filepath.Join(dir, "cgroup.kill"), []byte("1"), 0)
+		if nil == err {
+			return nil
+		}
+	}
+
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return fmt.Errorf("unsupported signal %v", sig)
+	}
+
+	pids, err := cgroupPids(dir)
+	if nil != err {
+		return err
+	}
+	for _, pid := range pids {
+		e := syscall.Kill(pid, s)
+		if nil != e && !errors.Is(e, syscall.ESRCH) {
+			err = e
+		}
+	}
+	return err
+}
+
+// cleanCgroup kills processes left in cgroup (if kill is true)
+// and removes it
+func (t *Task) cleanCgroup(slot int, out io.Writer, kill bool) {
+	dir := t.cgroupDir(slot)
+	pids, err := cgroupPids(dir)
+	if nil != err {
+		return
+	}
+
+	if len(pids) > 0 {
+		if !kill {
+			fmt.Fprintln(out, "[minisv] Processes left in cgroup:", pids)
+			return
+		}
+		fmt.Fprintln(out, "[minisv] Killing remaining processes of cgroup:", pids)
+		err = t.signalCgroup(slot, syscall.SIGKILL)
+		if nil != err {
+			fmt.Fprintln(out, "[minisv] Error killing cgroup processes: ", err)
+		}
+	}
+
+	// cgroup can be removed only after all killed processes are gone
+	for i := 0; i < 50; i++ {
+		err = syscall.Rmdir(dir)
+		if !errors.Is(err, syscall.EBUSY) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if nil != err {
+		fmt.Fprintln(out, "[minisv] Error removing cgroup: ", err)
+	}
+}
+
+// removeCgroup removes cgroup of task, should be called after all processes
+// of task are finished
+func (t *Task) removeCgroup() {
+	// cgroups of slots are left by cleanCgroup only with processes
+	// (without killMode cgroup), which could finish since then
+	for slot := 0; slot < 2; slot++ {
+		_ = syscall.Rmdir(t.cgroupDir(slot))
+	}
+
+	err := syscall.Rmdir(t.cgroupTaskDir())
+	if nil != err && !errors.Is(err, syscall.ENOENT) {
+		log.Printf("Error removing cgroup of task %s: %v\n", t.name, err)
+	}
+}
+
+// cgroupUsage returns cpu time in seconds and current memory usage in bytes
+// of all processes of task
+func (t *Task) cgroupUsage() (float64, uint64) {
+	dir := t.cgroupTaskDir()
+
+	var cpu float64
+	data, err := os.ReadFile(filepath.Join(dir, "cpu.stat"))
+	if nil == err {
+		for _, line := range strings.Split(string(data), "\n") {
+			if value, ok := strings.CutPrefix(line, "usage_usec "); ok {
+				usec, _ := strconv.ParseUint(value, 10, 64)
+				cpu = float64(usec) / 1e6
+				break
+			}
+		}
+	}
+
+	var memory uint64
+	data, err = os.ReadFile(filepath.Join(dir, "memory.current"))
+	if nil == err {
+		memory, _ = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	}
+
+	return cpu, memory
+}
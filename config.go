@@ -2,7 +2,9 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"net"
 	"os"
@@ -39,6 +41,9 @@ type Config struct {
 	LogDate        string           `json:"logdate"`
 	LogReopen      *configDuration  `json:"logreopen"`
 	LogBufferLines int              `json:"logbufferlines"` // Number of log lines to keep in memory buffer
+	RunHistory     int              `json:"runhistory"`     // Number of one-time task runs to keep
+	ConfigHistory  int              `json:"confighistory"`  // Number of saved config versions to keep
+	CgroupParent   string           `json:"cgroupparent"`   // Parent cgroup of all tasks cgroups
 	GrayLog        grayLogConfig    `json:"graylog"`
 	Tasks          map[string]*Task `json:"tasks"`
 	Limits         []configRLimit   `json:"limits"`
@@ -60,26 +65,25 @@ var (
 
 var (
 	configfile = flag.String("config", "/etc/minisv.json",
-		"minisv config file in json format")
+		"minisv config file in json, yaml or toml format")
 )
 
-func readConfig() bool {
+// loadConfig reads and validates config file, returns also its content
+func loadConfig() (*Config, []byte, error) {
 	data, err := os.ReadFile(*configfile)
 	if nil != err {
-		log.Println("Error reading config file: ", err)
-		return false
+		return nil, nil, fmt.Errorf("error reading config file: %w", err)
 	}
 
-	var config Config
-
-	err = json.Unmarshal(data, &config)
-	if nil != err {
-		log.Println("Error parsing config file: ", err)
-		return false
-	}
+	config, err := parseConfig(data)
+	return config, data, err
+}
 
-	for name, task := range config.Tasks {
-		task.name = name
+// parseConfig validates config and prepares it for use
+func parseConfig(data []byte) (*Config, error) {
+	config, problems := validateConfig(data, false)
+	if len(problems) > 0 {
+		return nil, problems
 	}
 
 	// Set default value for LogBufferLines if not specified
@@ -100,16 +104,32 @@ func readConfig() bool {
 
 	}
 
-	aConfig.Store(&config)
+	return config, nil
+}
+
+func readConfig() bool {
+	config, data, err := loadConfig()
+	if nil != err {
+		var problems configProblems
+		if errors.As(err, &problems) {
+			for _, problem := range problems {
+				log.Println("Invalid config:", problem)
+			}
+		} else {
+			log.Println("Error loading config:", err)
+		}
+		return false
+	}
+
+	aConfig.Store(config)
+	recordConfigVersion(data, "start")
 
 	return true
 }
 
-var (
-	saveMutex sync.Mutex
-)
-
-func saveConfig() {
+// saveConfig writes current config to file (in format of file) and to
+// history, trigger describes change (like api request)
+func saveConfig(trigger string) {
 	saveMutex.Lock()
 	defer saveMutex.Unlock()
 
@@ -119,9 +139,16 @@ func saveConfig() {
 		return
 	}
 
-	err = os.WriteFile(*configfile, data, 0644)
+	// comments of yaml file are kept
+	old, _ := os.ReadFile(*configfile)
+	data, err = configFromJSON(data, old)
 	if nil != err {
-		log.Println("Error on config save:", err)
+		log.Println("Error encoding config for save:", err)
 		return
 	}
+
+	err = storeConfig(data, trigger)
+	if nil != err {
+		log.Println("Error on config save:", err)
+	}
 }
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	formatJSON = "json"
+	formatYAML = "yaml"
+	formatTOML = "toml"
+)
+
+var (
+	configformat = flag.String("format", "",
+		"format of config file: json, yaml or toml (default by file extension)")
+
+	// keys which are always present in JSON of config (fields without
+	// omitempty), they are written to YAML and TOML only if not empty
+	defaultKeys = collectKeys(&Config{Tasks: map[string]*Task{"": {}}})
+)
+
+// collectKeys returns names of all keys in JSON of value
+func collectKeys(value interface{}) map[string]bool {
+	keys := map[string]bool{}
+	data, err := json.Marshal(value)
+	if nil != err {
+		return keys
+	}
+	doc, err := decodeJSON(data)
+	if nil != err {
+		return keys
+	}
+
+	var walk func(value interface{})
+	walk = func(value interface{}) {
+		if m, ok := value.(map[string]interface{}); ok {
+			for key, item := range m {
+				keys[key] = true
+				walk(item)
+			}
+		}
+	}
+	walk(doc)
+
+	return keys
+}
+
+// isDefault returns true if key can be omitted in file without change
+// of meaning
+func isDefault(key string, value interface{}) bool {
+	return nil == value || (defaultKeys[key] && isZero(value))
+}
+
+// configFormat returns format of config file from -format or extension
+func configFormat() (string, error) {
+	switch *configformat {
+	case formatJSON, formatYAML, formatTOML:
+		return *configformat, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unknown config format \"%s\"", *configformat)
+	}
+
+	switch strings.ToLower(filepath.Ext(*configfile)) {
+	case ".yaml", ".yml":
+		return formatYAML, nil
+	case ".toml":
+		return formatTOML, nil
+	}
+	return formatJSON, nil
+}
+
+// configToJSON converts config file content to JSON, so all formats use
+// the same json tags and decoders (configDuration)
+func configToJSON(data []byte) ([]byte, error) {
+	format, err := configFormat()
+	if nil != err {
+		return nil, err
+	}
+
+	var doc interface{}
+	switch format {
+	case formatYAML:
+		err = yaml.Unmarshal(data, &doc)
+	case formatTOML:
+		var m map[string]interface{}
+		err = toml.Unmarshal(data, &m)
+		doc = m
+	default:
+		return data, nil
+	}
+	if nil != err {
+		return nil, err
+	}
+
+	envToStrings(doc)
+	return json.Marshal(doc)
+}
+
+// envToStrings converts scalar values of env of tasks (like PORT: 8080)
+// to strings, as in YAML and TOML they are usually written without quotes
+func envToStrings(doc interface{}) {
+	root, _ := doc.(map[string]interface{})
+	tasks, _ := root["tasks"].(map[string]interface{})
+	for _, task := range tasks {
+		t, _ := task.(map[string]interface{})
+		env, _ := t["env"].(map[string]interface{})
+		for key, value := range env {
+			switch v := value.(type) {
+			case nil, string, map[string]interface{}, []interface{}:
+				// wrong types are reported by decoder
+			case float64:
+				env[key] = strconv.FormatFloat(v, 'f', -1, 64)
+			default:
+				env[key] = fmt.Sprint(v)
+			}
+		}
+	}
+}
+
+// decodeJSON decodes JSON with integer numbers kept as int64
+func decodeJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var doc interface{}
+	err := decoder.Decode(&doc)
+	if nil != err {
+		return nil, err
+	}
+	return normalizeJSON(doc), nil
+}
+
+// normalizeJSON converts json.Number to int64 or float64
+func normalizeJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); nil == err {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeJSON(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeJSON(item)
+		}
+	}
+	return value
+}
+
+// dropDefaults removes empty values (nulls can't be encoded in TOML)
+func dropDefaults(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if isDefault(key, item) {
+				delete(v, key)
+				continue
+			}
+			v[key] = dropDefaults(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = dropDefaults(item)
+		}
+	}
+	return value
+}
+
+// configFromJSON converts JSON config to format of config file, old content
+// of file is used to keep comments and layout of YAML
+func configFromJSON(data []byte, old []byte) ([]byte, error) {
+	format, err := configFormat()
+	if nil != err {
+		return nil, err
+	}
+	if format == formatJSON {
+		return data, nil
+	}
+
+	doc, err := decodeJSON(data)
+	if nil != err {
+		return nil, err
+	}
+
+	if format == formatTOML {
+		var buf bytes.Buffer
+		err = toml.NewEncoder(&buf).Encode(dropDefaults(doc))
+		return buf.Bytes(), err
+	}
+
+	var root yaml.Node
+	if err = yaml.Unmarshal(old, &root); nil != err || len(root.Content) == 0 {
+		root = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{}}}
+	}
+	err = mergeYAML(root.Content[0], doc)
+	if nil != err {
+		return nil, fmt.Errorf("unable to keep layout of YAML file: %w", err)
+	}
+	untagMergeKeys(&root)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	err = encoder.Encode(&root)
+	if nil == err {
+		err = encoder.Close()
+	}
+	return buf.Bytes(), err
+}
+
+// isZero returns true for empty values
+func isZero(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case bool:
+		return !v
+	case int64:
+		return v == 0
+	case float64:
+		return v == 0
+	case map[string]interface{}:
+		for _, item := range v {
+			if !isZero(item) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// mergeYAML updates node to contain value, keeping comments and style
+// of unchanged parts; anchors, aliases and merge keys (<<) are kept only if
+// their value is unchanged, otherwise error is returned as changing them
+// would change other parts of file too
+func mergeYAML(node *yaml.Node, value interface{}) error {
+	if node.Kind == yaml.AliasNode || node.Anchor != "" || hasMergeKey(node) {
+		if sameYAML(node, value) {
+			return nil
+		}
+		switch {
+		case node.Kind == yaml.AliasNode:
+			return fmt.Errorf("value of alias *%s is changed", node.Value)
+		case node.Anchor != "":
+			return fmt.Errorf("value of anchor &%s is changed", node.Anchor)
+		}
+		return fmt.Errorf("mapping with merge key at line %d is changed", node.Line)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if node.Kind != yaml.MappingNode {
+			if err := checkDropYAML(node); nil != err {
+				return err
+			}
+			*node = yaml.Node{Kind: yaml.MappingNode, HeadComment: node.HeadComment}
+		}
+
+		// update or remove existing keys
+		content := make([]*yaml.Node, 0, len(node.Content))
+		seen := map[string]bool{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, item := node.Content[i], node.Content[i+1]
+			newItem, ok := v[key.Value]
+			if !ok {
+				if err := checkDropYAML(item); nil != err {
+					return err
+				}
+				continue
+			}
+			seen[key.Value] = true
+			if err := mergeYAML(item, newItem); nil != err {
+				return err
+			}
+			content = append(content, key, item)
+		}
+
+		// add new non-empty keys in stable order
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			if !seen[key] && !isDefault(key, v[key]) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			item := &yaml.Node{}
+			_ = mergeYAML(item, v[key]) // new node has no anchors
+			content = append(content,
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, item)
+		}
+		node.Content = content
+
+	case []interface{}:
+		if node.Kind != yaml.SequenceNode {
+			if err := checkDropYAML(node); nil != err {
+				return err
+			}
+			*node = yaml.Node{Kind: yaml.SequenceNode, HeadComment: node.HeadComment}
+		}
+		if len(node.Content) > len(v) {
+			for _, item := range node.Content[len(v):] {
+				if err := checkDropYAML(item); nil != err {
+					return err
+				}
+			}
+			node.Content = node.Content[:len(v)]
+		}
+		for i, item := range v {
+			if i == len(node.Content) {
+				node.Content = append(node.Content, &yaml.Node{})
+			}
+			if err := mergeYAML(node.Content[i], item); nil != err {
+				return err
+			}
+		}
+
+	default:
+		if node.Kind == yaml.MappingNode || node.Kind == yaml.SequenceNode {
+			if err := checkDropYAML(node); nil != err {
+				return err
+			}
+		}
+		mergeYAMLScalar(node, v)
+	}
+
+	return nil
+}
+
+// hasMergeKey returns true if node is mapping with merge key (<<)
+func hasMergeKey(node *yaml.Node) bool {
+	if node.Kind != yaml.MappingNode {
+		return false
+	}
+	for i := 0; i < len(node.Content); i += 2 {
+		if node.Content[i].ShortTag() == "!!merge" {
+			return true
+		}
+	}
+	return false
+}
+
+// untagMergeKeys clears tag of merge keys, otherwise encoder writes them
+// as "!!merge <<"
+func untagMergeKeys(node *yaml.Node) {
+	if hasMergeKey(node) {
+		for i := 0; i < len(node.Content); i += 2 {
+			if node.Content[i].ShortTag() == "!!merge" {
+				node.Content[i].Tag = ""
+			}
+		}
+	}
+	for _, item := range node.Content {
+		untagMergeKeys(item)
+	}
+}
+
+// checkDropYAML returns error if node to be removed contains anchor,
+// as aliases of it would be left without value
+func checkDropYAML(node *yaml.Node) error {
+	if node.Anchor != "" {
+		return fmt.Errorf("anchor &%s is removed", node.Anchor)
+	}
+	for _, item := range node.Content {
+		if err := checkDropYAML(item); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameYAML returns true if node (with aliases and merge keys resolved)
+// already contains value
+func sameYAML(node *yaml.Node, value interface{}) bool {
+	resolved := resolveYAML(node)
+	merged := resolveYAML(node)
+	if nil != mergeYAML(merged, value) {
+		return false
+	}
+
+	data, err1 := yaml.Marshal(resolved)
+	newData, err2 := yaml.Marshal(merged)
+	return nil == err1 && nil == err2 && string(data) == string(newData)
+}
+
+// resolveYAML returns copy of node with aliases replaced by their values,
+// keys of merge keys (<<) added to mappings and anchors removed
+func resolveYAML(node *yaml.Node) *yaml.Node {
+	if node.Kind == yaml.AliasNode && nil != node.Alias {
+		return resolveYAML(node.Alias)
+	}
+
+	result := *node
+	result.Anchor = ""
+	result.Content = nil
+
+	if node.Kind != yaml.MappingNode {
+		for _, item := range node.Content {
+			result.Content = append(result.Content, resolveYAML(item))
+		}
+		return &result
+	}
+
+	// own keys have priority over merged ones, earlier merged mappings
+	// over later ones
+	keys := map[string]bool{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].ShortTag() != "!!merge" {
+			keys[node.Content[i].Value] = true
+		}
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, item := node.Content[i], resolveYAML(node.Content[i+1])
+		if key.ShortTag() != "!!merge" {
+			result.Content = append(result.Content, resolveYAML(key), item)
+			continue
+		}
+
+		sources := []*yaml.Node{item}
+		if item.Kind == yaml.SequenceNode {
+			sources = item.Content
+		}
+		for _, source := range sources {
+			for j := 0; j+1 < len(source.Content); j += 2 {
+				if !keys[source.Content[j].Value] {
+					keys[source.Content[j].Value] = true
+					result.Content = append(result.Content,
+						source.Content[j], source.Content[j+1])
+				}
+			}
+		}
+	}
+	return &result
+}
+
+// mergeYAMLScalar updates scalar node if its value is changed,
+// durations are compared by value ("60s" is the same as "1m0s")
+func mergeYAMLScalar(node *yaml.Node, value interface{}) {
+	var tag, text string
+	switch v := value.(type) {
+	case nil:
+		tag, text = "!!null", "null"
+	case bool:
+		tag, text = "!!bool", strconv.FormatBool(v)
+	case int64:
+		tag, text = "!!int", strconv.FormatInt(v, 10)
+	case float64:
+		tag, text = "!!float", strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		tag, text = "!!str", v
+	default:
+		tag, text = "!!str", fmt.Sprint(v)
+	}
+
+	// unquoted env values (PORT: 8080) are strings after decoding
+	if node.Kind == yaml.ScalarNode && tag == "!!str" && node.Value == text {
+		return
+	}
+	if node.Kind == yaml.ScalarNode && node.ShortTag() == tag {
+		if node.Value == text {
+			return
+		}
+		if tag == "!!str" {
+			d1, err1 := time.ParseDuration(node.Value)
+			d2, err2 := time.ParseDuration(text)
+			if nil == err1 && nil == err2 && d1 == d2 {
+				return
+			}
+		}
+	}
+
+	comments := [3]string{node.HeadComment, node.LineComment, node.FootComment}
+	*node = yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: text}
+	node.HeadComment, node.LineComment, node.FootComment = comments[0], comments[1], comments[2]
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultConfigHistory = 20
+	configHistoryIndex   = "history.json"
+)
+
+var (
+	saveMutex sync.Mutex // protects config file and history
+
+	errVersionNotFound = errors.New("config version not found")
+)
+
+// configVersion describes one saved version of config file
+type configVersion struct {
+	Version int       `json:"version"`
+	Time    time.Time `json:"time"`
+	Trigger string    `json:"trigger"` // what caused change: "start", api request, ...
+	File    string    `json:"file"`    // copy of config file
+}
+
+// configHistoryDir returns directory with previous versions of config
+func configHistoryDir() string {
+	return *configfile + ".history"
+}
+
+// writeFileAtomic replaces file with new content, so file contains either
+// old or new content even after crash; mode and owner of existing file are
+// kept, perm is used for new file
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	uid, gid := -1, -1
+	if info, err := os.Stat(filename); nil == err {
+		perm = info.Mode().Perm()
+		if st, ok := info.Sys().(*syscall.Stat_t); ok {
+			uid, gid = int(st.Uid), int(st.Gid)
+		}
+	}
+
+	dir := filepath.Dir(filename)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(filename)+".*.tmp")
+	if nil != err {
+		return err
+	}
+	// no-op after successful rename
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if nil == err && uid >= 0 {
+		// without privileges file stays owned by minisv user
+		_ = tmp.Chown(uid, gid)
+	}
+	if nil == err {
+		err = tmp.Chmod(perm)
+	}
+	if nil == err {
+		err = tmp.Sync()
+	}
+	if e := tmp.Close(); nil == err {
+		err = e
+	}
+	if nil != err {
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), filename)
+	if nil != err {
+		return err
+	}
+
+	// make rename durable
+	d, err := os.Open(dir)
+	if nil != err {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// readConfigHistory returns saved versions, oldest first
+func readConfigHistory() ([]configVersion, error) {
+	data, err := os.ReadFile(filepath.Join(configHistoryDir(), configHistoryIndex))
+	if os.IsNotExist(err) {
+		return []configVersion{}, nil
+	}
+	if nil != err {
+		return nil, err
+	}
+
+	var versions []configVersion
+	err = json.Unmarshal(data, &versions)
+	return versions, err
+}
+
+// addConfigVersion stores content of config in history if it differs from
+// the last saved version and removes the oldest versions over limit,
+// saveMutex should be held
+func addConfigVersion(data []byte, trigger string) error {
+	dir := configHistoryDir()
+	err := os.MkdirAll(dir, 0700)
+	if nil != err {
+		return err
+	}
+
+	versions, err := readConfigHistory()
+	if nil != err {
+		return err
+	}
+
+	next := 1
+	if len(versions) > 0 {
+		last := versions[len(versions)-1]
+		old, err := os.ReadFile(filepath.Join(dir, last.File))
+		if nil == err && bytes.Equal(old, data) {
+			return nil
+		}
+		next = last.Version + 1
+	}
+
+	version := configVersion{
+		Version: next,
+		Time:    time.Now(),
+		Trigger: trigger,
+		File:    strconv.Itoa(next) + filepath.Ext(*configfile),
+	}
+	err = writeFileAtomic(filepath.Join(dir, version.File), data, 0600)
+	if nil != err {
+		return err
+	}
+	versions = append(versions, version)
+
+	limit := defaultConfigHistory
+	if config := aConfig.Load(); nil != config && config.ConfigHistory > 0 {
+		limit = config.ConfigHistory
+	}
+	for len(versions) > limit {
+		err = os.Remove(filepath.Join(dir, versions[0].File))
+		if nil != err && !os.IsNotExist(err) {
+			log.Println("Error removing old config version: ", err)
+		}
+		versions = versions[1:]
+	}
+
+	index, err := json.MarshalIndent(versions, "", "  ")
+	if nil != err {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, configHistoryIndex), index, 0600)
+}
+
+// recordConfigVersion stores content of config file in history
+// (used when config file was changed outside of minisv)
+func recordConfigVersion(data []byte, trigger string) {
+	saveMutex.Lock()
+	defer saveMutex.Unlock()
+
+	err := addConfigVersion(data, trigger)
+	if nil != err {
+		log.Println("Error saving config history:", err)
+	}
+}
+
+// writeConfig atomically replaces config file and stores new version
+// in history
+func writeConfig(data []byte, trigger string) error {
+	saveMutex.Lock()
+	defer saveMutex.Unlock()
+
+	return storeConfig(data, trigger)
+}
+
+// storeConfig is writeConfig for callers holding saveMutex
+func storeConfig(data []byte, trigger string) error {
+	err := writeFileAtomic(*configfile, data, 0600)
+	if nil != err {
+		return err
+	}
+
+	err = addConfigVersion(data, trigger)
+	if nil != err {
+		log.Println("Error saving config history:", err)
+	}
+	return nil
+}
+
+// getConfigHistory returns saved versions of config, newest first
+func getConfigHistory() ([]configVersion, error) {
+	saveMutex.Lock()
+	defer saveMutex.Unlock()
+
+	versions, err := readConfigHistory()
+	if nil != err {
+		return nil, err
+	}
+
+	result := make([]configVersion, 0, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		result = append(result, versions[i])
+	}
+	return result, nil
+}
+
+// readConfigVersion returns content of saved version of config
+func readConfigVersion(version int) ([]byte, error) {
+	saveMutex.Lock()
+	defer saveMutex.Unlock()
+
+	versions, err := readConfigHistory()
+	if nil != err {
+		return nil, err
+	}
+
+	for _, v := range versions {
+		if v.Version == version {
+			return os.ReadFile(filepath.Join(configHistoryDir(), v.File))
+		}
+	}
+	return nil, errVersionNotFound
+}
+
+// rollbackConfig applies saved version of config to running tasks the same
+// way as reload and writes it to config file
+func rollbackConfig(version int, trigger string) (*reloadReport, error) {
+	data, err := readConfigVersion(version)
+	if nil != err {
+		return nil, err
+	}
+
+	config, err := parseConfig(data)
+	if nil != err {
+		return nil, fmt.Errorf("version %d is not valid: %w", version, err)
+	}
+
+	report, err := applyConfig(config)
+	if nil != err {
+		return nil, err
+	}
+
+	err = writeConfig(data, fmt.Sprintf("%s (rollback to version %d)", trigger, version))
+	if nil != err {
+		log.Println("Error on config save:", err)
+	}
+
+	return report, nil
+}
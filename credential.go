@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// lookupUser accepts both user name and numeric uid
+func lookupUser(name string) (*user.User, error) {
+	u, err := user.Lookup(name)
+	if nil == err {
+		return u, nil
+	}
+	if _, e := strconv.ParseUint(name, 10, 32); nil == e {
+		return user.LookupId(name)
+	}
+	return nil, err
+}
+
+// lookupGroup accepts both group name and numeric gid and returns gid
+func lookupGroup(name string) (uint32, error) {
+	g, err := user.LookupGroup(name)
+	if nil != err {
+		if _, e := strconv.ParseUint(name, 10, 32); nil != e {
+			return 0, err
+		}
+		g, err = user.LookupGroupId(name)
+		if nil != err {
+			return 0, err
+		}
+	}
+
+	gid, err := strconv.ParseUint(g.Gid, 10, 32)
+	if nil != err {
+		return 0, fmt.Errorf("invalid gid of group %s: %w", name, err)
+	}
+	return uint32(gid), nil
+}
+
+// credential resolves user, group and supplementaryGroups of task,
+// returns nil if child should run with minisv's own credentials
+func (t *Task) credential() (*syscall.Credential, error) {
+	if t.User == "" && t.Group == "" && len(t.SupplementaryGroups) == 0 {
+		return nil, nil
+	}
+
+	cred := &syscall.Credential{
+		Uid:    uint32(syscall.Getuid()),
+		Gid:    uint32(syscall.Getgid()),
+		Groups: []uint32{},
+	}
+
+	if t.User != "" {
+		u, err := lookupUser(t.User)
+		if nil != err {
+			return nil, fmt.Errorf("user lookup: %w", err)
+		}
+		uid, err := strconv.ParseUint(u.Uid, 10, 32)
+		if nil != err {
+			return nil, fmt.Errorf("invalid uid of user %s: %w", t.User, err)
+		}
+		gid, err := strconv.ParseUint(u.Gid, 10, 32)
+		if nil != err {
+			return nil, fmt.Errorf("invalid gid of user %s: %w", t.User, err)
+		}
+		cred.Uid = uint32(uid)
+		cred.Gid = uint32(gid) // primary group of user if no group specified
+	}
+
+	if t.Group != "" {
+		gid, err := lookupGroup(t.Group)
+		if nil != err {
+			return nil, fmt.Errorf("group lookup: %w", err)
+		}
+		cred.Gid = gid
+	}
+
+	for _, name := range t.SupplementaryGroups {
+		gid, err := lookupGroup(name)
+		if nil != err {
+			return nil, fmt.Errorf("supplementary group lookup: %w", err)
+		}
+		cred.Groups = append(cred.Groups, gid)
+	}
+
+	return cred, nil
+}
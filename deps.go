@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	dependencyCheckInterval = 500 * time.Millisecond
+)
+
+// checkDependencies returns error if some task depends on unknown task
+// or if there is a cycle in dependsOn/after relations
+func checkDependencies(tasks map[string]*Task) error {
+	for name, task := range tasks {
+		for _, dep := range task.DependsOn {
+			if _, ok := tasks[dep]; !ok {
+				return fmt.Errorf("task %s depends on unknown task %s", name, dep)
+			}
+		}
+	}
+
+	// 0 - not visited, 1 - in progress, 2 - done
+	state := map[string]int{}
+	var path []string
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("dependency cycle: %s -> %s",
+				strings.Join(path, " -> "), name)
+		case 2:
+			return nil
+		}
+
+		state[name] = 1
+		path = append(path, name)
+		for _, dep := range tasks[name].dependencies() {
+			if _, ok := tasks[dep]; !ok {
+				continue // unknown "after" tasks are just ignored
+			}
+			if err := visit(dep); nil != err {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = 2
+
+		return nil
+	}
+
+	for name := range tasks {
+		if err := visit(name); nil != err {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dependencies returns names of all tasks which should be started before
+func (t *Task) dependencies() []string {
+	return append(append([]string{}, t.DependsOn...), t.After...)
+}
+
+// dependsOnTask returns true if task should be started after given one
+// and stopped before it
+func (t *Task) dependsOnTask(name string) bool {
+	for _, dep := range t.dependencies() {
+		if dep == name {
+			return true
+		}
+	}
+	return false
+}
+
+// stopOrder returns tasks in order of stopping: dependent tasks are stopped
+// before tasks they depend on, the same way as on exit (see waitDependents)
+func stopOrder(tasks []*Task) []*Task {
+	sorted := append([]*Task{}, tasks...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].name < sorted[j].name
+	})
+
+	result := make([]*Task, 0, len(sorted))
+	visited := map[*Task]bool{}
+
+	var visit func(task *Task)
+	visit = func(task *Task) {
+		if visited[task] {
+			return
+		}
+		visited[task] = true
+		for _, other := range sorted {
+			if other.dependsOnTask(task.name) {
+				visit(other)
+			}
+		}
+		result = append(result, task)
+	}
+
+	for _, task := range sorted {
+		visit(task)
+	}
+	return result
+}
+
+// exitedChan is closed when Loop of task is finished
+func (t *Task) exitedChan() chan bool {
+	t.exitedOnce.Do(func() {
+		t.exited = make(chan bool)
+	})
+	return t.exited
+}
+
+// dependencyReady returns true if task is ready for dependent tasks:
+// running (and healthy if health check is defined) or successfully
+// finished for one-time tasks
+func (t *Task) dependencyReady() bool {
+	state := t.getState()
+	if t.OneTime {
+		return state == StateFinished
+	}
+	if !state.Running() {
+		return false
+	}
+	if nil != t.HealthCheck {
+		if instances := t.getInstances(); len(instances) > 0 {
+			return instancesHealth(instances) == "healthy"
+		}
+		health, _ := t.health.Load().(string)
+		return health == "healthy"
+	}
+	return true
+}
+
+// waitDependencies blocks until all dependsOn tasks are ready and all
+// existing "after" tasks were at least started,
+// returns false if task should exit instead
+func (t *Task) waitDependencies(out io.Writer, cExit chan bool) bool {
+	if len(t.DependsOn) == 0 && len(t.After) == 0 {
+		return true
+	}
+
+	ticker := time.NewTicker(dependencyCheckInterval)
+	defer ticker.Stop()
+
+	logged := ""
+	for {
+		var waiting []string
+		tasks := aConfig.Load().Tasks
+
+		for _, name := range t.DependsOn {
+			dep, ok := tasks[name]
+			if !ok || !dep.dependencyReady() {
+				waiting = append(waiting, name)
+			}
+		}
+		for _, name := range t.After {
+			dep, ok := tasks[name]
+			if !ok || dep.OneTime {
+				continue
+			}
+			switch dep.getState() {
+			case StateNotStarted, StateWaitingDeps, StateStarting:
+				waiting = append(waiting, name)
+			}
+		}
+
+		if len(waiting) == 0 {
+			return true
+		}
+
+		if list := strings.Join(waiting, ", "); list != logged {
+			fmt.Fprintln(out, "[minisv] Waiting for dependencies:", list)
+			logged = list
+		}
+		t.setState(StateWaitingDeps, nil)
+
+		select {
+		case <-cExit:
+			return false
+		case <-t.eSignal:
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// waitDependents blocks until all tasks depending on this one are stopped,
+// used for shutdown in reverse order
+func (t *Task) waitDependents(out io.Writer) {
+	for name, task := range aConfig.Load().Tasks {
+		if task.OneTime || task == t {
+			continue
+		}
+		if task.dependsOnTask(t.name) {
+			fmt.Fprintln(out, "[minisv] Waiting for", name, "to stop first")
+			<-task.exitedChan()
+		}
+	}
+}
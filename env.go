@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// parseEnvFile reads variables from file in dotenv format:
+// KEY=value lines, optional "export " prefix, # comments and
+// single/double quoted values (escapes are processed only in double quotes)
+func parseEnvFile(filename string) ([]string, error) {
+	data, err := os.ReadFile(filename)
+	if nil != err {
+		return nil, err
+	}
+
+	var result []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("%s:%d: invalid line", filename, lineNo)
+		}
+
+		value = strings.TrimSpace(value)
+		switch {
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			value, err = strconv.Unquote(value)
+			if nil != err {
+				return nil, fmt.Errorf("%s:%d: %w", filename, lineNo, err)
+			}
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		default:
+			// strip inline comment from unquoted value
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+		}
+
+		result = append(result, key+"="+value)
+	}
+
+	return result, scanner.Err()
+}
+
+// buildEnv returns environment for child process: minisv's own environment
+// (unless clearEnv is set), then all envFiles in order and env map at the end,
+// so later definitions win
+func (t *Task) buildEnv() ([]string, error) {
+	own := []string{}
+
+	for _, filename := range t.EnvFiles {
+		vars, err := parseEnvFile(filename)
+		if nil != err {
+			return nil, fmt.Errorf("env file: %w", err)
+		}
+		own = append(own, vars...)
+	}
+
+	keys := make([]string, 0, len(t.Env))
+	for key := range t.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		own = append(own, key+"="+t.Env[key])
+	}
+
+	t.envApplied.Store(maskEnv(own))
+
+	if t.ClearEnv {
+		return own, nil
+	}
+
+	return append(os.Environ(), own...), nil
+}
+
+// maskEnv hides values of variables, keeping only unique names
+func maskEnv(env []string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, kv := range env {
+		key, _, _ := strings.Cut(kv, "=")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, key+"=***")
+	}
+	sort.Strings(result)
+	return result
+}
@@ -3,11 +3,13 @@ module github.com/kanocz/minisv
 go 1.22
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/go-chi/chi v1.5.5
 	github.com/go-chi/render v1.0.3
 	github.com/kavu/go_reuseport v1.5.0
 	github.com/tylerb/graceful v1.2.15
 	golang.org/x/crypto v0.23.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require github.com/ajg/form v1.5.1 // indirect
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	defaultHealthInterval  = 10 * time.Second
+	defaultHealthTimeout   = 5 * time.Second
+	defaultHealthThreshold = 3
+)
+
+// probeConfig describes one check of task (used by health and readiness checks)
+type probeConfig struct {
+	Type    string         `json:"type"`              // http, tcp or exec
+	URL     string         `json:"url,omitempty"`     // for http
+	Status  int            `json:"status,omitempty"`  // expected http status, any 2xx if 0
+	Address string         `json:"address,omitempty"` // host:port for tcp
+	Command string         `json:"command,omitempty"` // for exec
+	Args    []string       `json:"args,omitempty"`    // for exec
+	Timeout configDuration `json:"timeout,omitempty"` // default 5s
+}
+
+func (p *probeConfig) timeout() time.Duration {
+	if p.Timeout <= 0 {
+		return defaultHealthTimeout
+	}
+	return time.Duration(p.Timeout)
+}
+
+// checkType validates type of probe
+func (p *probeConfig) checkType() error {
+	switch p.Type {
+	case "http", "tcp", "exec":
+		return nil
+	}
+	return fmt.Errorf("unknown probe type \"%s\"", p.Type)
+}
+
+// healthCheckConfig describes active check of running task
+type healthCheckConfig struct {
+	probeConfig
+	Interval  configDuration `json:"interval,omitempty"`         // default 10s
+	Threshold int            `json:"failureThreshold,omitempty"` // restart after N failures, default 3
+}
+
+func (h *healthCheckConfig) interval() time.Duration {
+	if h.Interval <= 0 {
+		return defaultHealthInterval
+	}
+	return time.Duration(h.Interval)
+}
+
+func (h *healthCheckConfig) threshold() int {
+	if h.Threshold <= 0 {
+		return defaultHealthThreshold
+	}
+	return h.Threshold
+}
+
+// checkHealthCheck validates health check of task
+func (t *Task) checkHealthCheck() error {
+	if nil == t.HealthCheck {
+		return nil
+	}
+	return t.HealthCheck.checkType()
+}
+
+// probe does one check, returns nil if everything is ok;
+// extraEnv is added to environment of exec probe
+func (t *Task) probe(h *probeConfig, extraEnv ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout())
+	defer cancel()
+
+	switch h.Type {
+	case "http":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.URL, nil)
+		if nil != err {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if nil != err {
+			return err
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		if h.Status != 0 && resp.StatusCode != h.Status {
+			return fmt.Errorf("unexpected http status %d", resp.StatusCode)
+		}
+		if h.Status == 0 && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+			return fmt.Errorf("unexpected http status %d", resp.StatusCode)
+		}
+		return nil
+
+	case "tcp":
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", h.Address)
+		if nil != err {
+			return err
+		}
+		return conn.Close()
+
+	case "exec":
+		cmd := exec.CommandContext(ctx, h.Command, h.Args...)
+		if t.WorkDir != "" {
+			cmd.Dir = t.WorkDir
+		}
+		env, err := t.buildEnv()
+		if nil != err {
+			return err
+		}
+		cmd.Env = append(env, extraEnv...)
+		var output bytes.Buffer
+		cmd.Stdout = &output
+		cmd.Stderr = &output
+		err = startProcess(cmd)
+		if nil == err {
+			err = waitProcess(cmd)
+		}
+		if nil != err {
+			if msg := strings.TrimSpace(output.String()); msg != "" {
+				return fmt.Errorf("%w: %s", err, msg)
+			}
+			return err
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown health check type \"%s\"", h.Type)
+}
+
+// healthLoop periodically checks running task and requests graceful restart
+// after configured number of failures in a row
+func (t *Task) healthLoop(h *healthCheckConfig, out io.Writer, stop chan bool) {
+	failures := 0
+	ticker := time.NewTicker(h.interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		// don't check while new instance is validated during graceful restart
+		// or while task is reloading its configuration
+		state := t.getState()
+		if state == StateRestartValidation || state == StateReloading {
+			continue
+		}
+		if !state.Running() {
+			failures = 0
+			t.health.Store("")
+			continue
+		}
+
+		err := t.probe(&h.probeConfig)
+		if nil == err {
+			if failures > 0 {
+				fmt.Fprintln(out, "[minisv] Health check ok")
+			}
+			failures = 0
+			t.health.Store("healthy")
+			continue
+		}
+
+		failures++
+		fmt.Fprintf(out, "[minisv] Health check failed (%d/%d): %v\n",
+			failures, h.threshold(), err)
+
+		if failures < h.threshold() {
+			continue
+		}
+
+		failures = 0
+		t.health.Store("unhealthy")
+		fmt.Fprintln(out, "[minisv] Task is unhealthy, restarting")
+		t.requestRestartReason("health check failed")
+
+		select {
+		case t.rSignal <- true:
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRunHistory = 20
+)
+
+// runRecord describes one run of one-time task in history
+type runRecord struct {
+	ID        string    `json:"id"`
+	Trigger   string    `json:"trigger"` // "http" or "schedule"
+	InputSize int       `json:"inputSize"`
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished,omitempty"`
+	Status    TaskState `json:"status"`
+	ExitCode  int       `json:"exitCode"`
+	Signal    string    `json:"signal,omitempty"`
+	Output    string    `json:"output,omitempty"` // file with output of this run
+}
+
+// runHistory is bounded list of runs of one task, oldest first, it's
+// saved next to output files to be available after restart of minisv
+type runHistory struct {
+	sync.RWMutex
+	runs   []*runRecord
+	loaded sync.Once
+}
+
+// newRunID returns time based id of run, unique for task as runs
+// of the same task can't be started in parallel
+func newRunID(started time.Time) string {
+	return strings.Replace(started.Format("20060102-150405.000000"), ".", "-", 1)
+}
+
+// runOutputFile returns name of file for output of one run
+func (t *Task) runOutputFile(id string) string {
+	config := aConfig.Load()
+	return fmt.Sprintf("%s/%s%s.run-%s.log",
+		config.LogDir, config.LogPrefix, t.name, id)
+}
+
+// openRunOutput creates output file of run, in case of error output is
+// discarded as it's still available in main task log
+func (t *Task) openRunOutput(record *runRecord) io.WriteCloser {
+	// saved history is needed before new file appears (see loadRuns)
+	t.loadRuns()
+
+	filename := t.runOutputFile(record.ID)
+	out, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if nil != err {
+		log.Printf("[minisv] Error creating run output file (%s): %v\n",
+			filename, err)
+		return nopWriteCloser{io.Discard}
+	}
+	record.Output = filename
+	return out
+}
+
+// runIndexFile returns name of file with saved run history of task
+func (t *Task) runIndexFile() string {
+	config := aConfig.Load()
+	return fmt.Sprintf("%s/%s%s.runs.json",
+		config.LogDir, config.LogPrefix, t.name)
+}
+
+// loadRuns reads saved run history on first use, output files of runs
+// which are not in history (left by crash) are removed
+func (t *Task) loadRuns() {
+	t.history.loaded.Do(func() {
+		t.history.Lock()
+		defer t.history.Unlock()
+
+		data, err := os.ReadFile(t.runIndexFile())
+		if nil == err {
+			err = json.Unmarshal(data, &t.history.runs)
+		}
+		if nil != err && !os.IsNotExist(err) {
+			log.Println("Error reading run history: ", err)
+		}
+
+		known := map[string]bool{}
+		for _, record := range t.history.runs {
+			known[record.Output] = true
+			// minisv was stopped during run
+			if record.Finished.IsZero() {
+				record.Status = StateFailed
+			}
+		}
+
+		files, _ := filepath.Glob(t.runOutputFile("*"))
+		for _, file := range files {
+			if known[file] {
+				continue
+			}
+			if err := os.Remove(file); nil != err {
+				log.Println("Error removing orphaned run output: ", err)
+			}
+		}
+	})
+}
+
+// saveRuns writes run history (history lock should be held)
+func (t *Task) saveRuns() {
+	data, err := json.Marshal(t.history.runs)
+	if nil == err {
+		err = writeFileAtomic(t.runIndexFile(), data, 0600)
+	}
+	if nil != err {
+		log.Println("Error saving run history: ", err)
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// addRun appends record to history and removes the oldest ones
+// (with their output files) over configured limit
+func (t *Task) addRun(record *runRecord) {
+	limit := aConfig.Load().RunHistory
+	if limit <= 0 {
+		limit = defaultRunHistory
+	}
+
+	t.loadRuns()
+
+	t.history.Lock()
+	defer t.history.Unlock()
+
+	t.history.runs = append(t.history.runs, record)
+	for len(t.history.runs) > limit {
+		old := t.history.runs[0]
+		t.history.runs = t.history.runs[1:]
+		if old.Output != "" {
+			if err := os.Remove(old.Output); nil != err && !os.IsNotExist(err) {
+				log.Println("Error removing old run output: ", err)
+			}
+		}
+	}
+	t.saveRuns()
+}
+
+// finishRun updates record in history after run end
+func (t *Task) finishRun(record *runRecord, result *RunResult) {
+	t.history.Lock()
+	defer t.history.Unlock()
+
+	record.Finished = result.Finished
+	record.Status = result.Status
+	record.ExitCode = result.ExitCode
+	record.Signal = result.Signal
+	t.saveRuns()
+}
+
+// getRuns returns copy of history, newest first
+func (t *Task) getRuns() []runRecord {
+	t.loadRuns()
+
+	t.history.RLock()
+	defer t.history.RUnlock()
+
+	result := make([]runRecord, 0, len(t.history.runs))
+	for i := len(t.history.runs) - 1; i >= 0; i-- {
+		result = append(result, *t.history.runs[i])
+	}
+	return result
+}
+
+// getRun returns copy of one run record
+func (t *Task) getRun(id string) (runRecord, bool) {
+	t.loadRuns()
+
+	t.history.RLock()
+	defer t.history.RUnlock()
+
+	for _, record := range t.history.runs {
+		if record.ID == id {
+			return *record, true
+		}
+	}
+	return runRecord{}, false
+}
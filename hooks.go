@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultHookTimeout = 30 * time.Second
+
+	hookPreStart  = "preStart"
+	hookPostStart = "postStart"
+	hookPreStop   = "preStop"
+	hookPostStop  = "postStop"
+)
+
+// hookConfig describes command executed around start or stop of process
+type hookConfig struct {
+	Command string         `json:"command"`
+	Args    []string       `json:"args,omitempty"`
+	Timeout configDuration `json:"timeout,omitempty"` // default 30s
+}
+
+func (h *hookConfig) timeout() time.Duration {
+	if h.Timeout <= 0 {
+		return defaultHookTimeout
+	}
+	return time.Duration(h.Timeout)
+}
+
+// hooksConfig contains all hooks of task, failed preStart aborts start,
+// result of other hooks is only logged
+type hooksConfig struct {
+	PreStart  *hookConfig `json:"preStart,omitempty"`
+	PostStart *hookConfig `json:"postStart,omitempty"`
+	PreStop   *hookConfig `json:"preStop,omitempty"`
+	PostStop  *hookConfig `json:"postStop,omitempty"`
+}
+
+// get returns hook by name or nil if not defined
+func (h *hooksConfig) get(name string) *hookConfig {
+	if nil == h {
+		return nil
+	}
+
+	switch name {
+	case hookPreStart:
+		return h.PreStart
+	case hookPostStart:
+		return h.PostStart
+	case hookPreStop:
+		return h.PreStop
+	case hookPostStop:
+		return h.PostStop
+	}
+	return nil
+}
+
+// checkHooks validates hooks of task
+func (t *Task) checkHooks() error {
+	for _, name := range []string{hookPreStart, hookPostStart, hookPreStop, hookPostStop} {
+		h := t.Hooks.get(name)
+		if nil == h {
+			continue
+		}
+		if h.Command == "" {
+			return fmt.Errorf("%s hook without command", name)
+		}
+		if h.Timeout < 0 {
+			return fmt.Errorf("%s hook timeout can't be negative", name)
+		}
+	}
+	return nil
+}
+
+// runHook executes hook (if defined) with environment, user and workdir of
+// task, pid of process (if any) is passed in MINISV_PID
+func (t *Task) runHook(name string, pid int, out io.Writer) error {
+	h := t.Hooks.get(name)
+	if nil == h {
+		return nil
+	}
+
+	fmt.Fprintf(out, "[minisv] Running %s hook %s %v\n", name, h.Command, h.Args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout())
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, h.Command, h.Args...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	// don't wait for output of processes left by hook after timeout
+	cmd.WaitDelay = time.Second
+	if t.WorkDir != "" {
+		cmd.Dir = t.WorkDir
+	}
+
+	env, err := t.buildEnv()
+	if nil != err {
+		return err
+	}
+	cmd.Env = append(env, "MINISV_HOOK="+name)
+	if pid != 0 {
+		cmd.Env = append(cmd.Env, "MINISV_PID="+strconv.Itoa(pid))
+	}
+
+	cred, err := t.credential()
+	if nil != err {
+		return err
+	}
+	if nil != cred {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: cred}
+	}
+
+	err = startProcess(cmd)
+	if nil == err {
+		err = waitProcess(cmd)
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timeout %v reached", h.timeout())
+	}
+	if nil != err {
+		fmt.Fprintf(out, "[minisv] %s hook failed: %v\n", name, err)
+		return fmt.Errorf("%s hook failed: %w", name, err)
+	}
+
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/x509"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
@@ -14,6 +15,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -115,9 +117,14 @@ func httpStart() *http.Server {
 	r.Route("/api", func(r chi.Router) {
 		r.Get("/", httpAllStatusAPI)
 		r.Get("/config", httpGetConfigInfo)
+		r.Get("/config/history", httpGetConfigHistory)
+		r.Post("/config/rollback/{version}", httpRollbackConfig)
+		r.Get("/reload", httpReloadConfig)
 		r.Route("/{id}", func(r chi.Router) {
 			r.Post("/", httpCreateTask)
 			r.Delete("/", httpDeleteTask)
+			r.Put("/", httpUpdateTask(false))
+			r.Patch("/", httpUpdateTask(true))
 			r.Get("/restart", httpRestartTask)
 			r.Get("/run", httpRunTask)
 			r.Post("/run", httpRunTaskWithInput)
@@ -128,6 +135,8 @@ func httpStart() *http.Server {
 			r.Get("/rotate", httpLogRotateTask)
 			r.Get("/status", httpStatusOfTast)
 			r.Get("/logs", httpGetTaskLogBuffer)
+			r.Get("/runs", httpGetTaskRuns)
+			r.Get("/runs/{runID}", httpGetTaskRun)
 		})
 	})
 
@@ -244,29 +253,65 @@ func httpRestartTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	task.requestRestartReason("http request")
 	task.rSignal <- true
 	_, _ = w.Write([]byte("ok"))
 }
 
-func httpRunTask(w http.ResponseWriter, r *http.Request) {
-	task := getTask(w, r, true)
-	if nil == task {
+// runTask starts one-time task; with ?wait=true request is blocked until
+// task is finished (or optional ?timeout=) and run result is returned
+func runTask(w http.ResponseWriter, r *http.Request, task *Task, input []byte) {
+	wait := r.URL.Query().Get("wait") == "true"
+
+	var timeout <-chan time.Time
+	if wait && r.URL.Query().Get("timeout") != "" {
+		d, err := time.ParseDuration(r.URL.Query().Get("timeout"))
+		if nil != err {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("invalid timeout: " + err.Error()))
+			return
+		}
+		timeout = time.After(d)
+	}
+
+	if !task.tryStartRun() {
+		if wait {
+			w.WriteHeader(http.StatusConflict)
+		}
+		_, _ = w.Write([]byte("just running"))
 		return
 	}
 
-	task.oneTimeMutex.Lock()
-	running := task.oneTimeRunning
-	if !running {
-		task.oneTimeRunning = true
+	if !wait {
+		go task.Run(input, "http", false)
+		_, _ = w.Write([]byte("ok"))
+		return
 	}
-	task.oneTimeMutex.Unlock()
-	if running {
-		_, _ = w.Write([]byte("just running"))
+
+	done := make(chan *RunResult, 1)
+	go func() {
+		done <- task.Run(input, "http", true)
+	}()
+
+	select {
+	case result := <-done:
+		render.JSON(w, r, result)
+	case <-timeout:
+		render.Status(r, http.StatusGatewayTimeout)
+		render.JSON(w, r, map[string]string{
+			"status": "running",
+			"error":  "timeout waiting for task",
+		})
+	}
+}
+
+func httpRunTask(w http.ResponseWriter, r *http.Request) {
+	task := getTask(w, r, true)
+	if nil == task {
 		return
 	}
 
-	go task.Run(nil)
-	_, _ = w.Write([]byte("ok"))
+	runTask(w, r, task, nil)
 }
 
 func httpRunTaskWithInput(w http.ResponseWriter, r *http.Request) {
@@ -291,19 +336,7 @@ func httpRunTaskWithInput(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	task.oneTimeMutex.Lock()
-	running := task.oneTimeRunning
-	if !running {
-		task.oneTimeRunning = true
-	}
-	task.oneTimeMutex.Unlock()
-	if running {
-		_, _ = w.Write([]byte("just running"))
-		return
-	}
-
-	go task.Run(body)
-	_, _ = w.Write([]byte("ok"))
+	runTask(w, r, task, body)
 }
 
 func httpStopTask(w http.ResponseWriter, r *http.Request) {
@@ -353,6 +386,62 @@ func httpLogRotateTask(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write([]byte("ok"))
 }
 
+// httpTrigger describes api request which changed config
+func httpTrigger(r *http.Request) string {
+	trigger := r.Method + " " + r.URL.Path + " from " + r.RemoteAddr
+	if user, _, ok := r.BasicAuth(); ok {
+		trigger += " (" + user + ")"
+	} else if nil != r.TLS && len(r.TLS.PeerCertificates) > 0 {
+		trigger += " (" + r.TLS.PeerCertificates[0].Subject.CommonName + ")"
+	}
+	return trigger
+}
+
+func httpGetConfigHistory(w http.ResponseWriter, r *http.Request) {
+	versions, err := getConfigHistory()
+	if nil != err {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	render.JSON(w, r, versions)
+}
+
+func httpRollbackConfig(w http.ResponseWriter, r *http.Request) {
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if nil != err {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("invalid version: " + err.Error()))
+		return
+	}
+
+	report, err := rollbackConfig(version, httpTrigger(r))
+	if errors.Is(err, errVersionNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+	if nil != err {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	render.JSON(w, r, report)
+}
+
+func httpReloadConfig(w http.ResponseWriter, r *http.Request) {
+	report, err := reloadConfig(httpTrigger(r))
+	if nil != err {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	render.JSON(w, r, report)
+}
+
 func httpDeleteTask(w http.ResponseWriter, r *http.Request) {
 	configChangeLock.Lock()
 	defer configChangeLock.Unlock()
@@ -365,9 +454,6 @@ func httpDeleteTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// exit task
-	close(task.eSignal)
-
 	newTasks := make(map[string]*Task, len(config.Tasks)+1)
 	for tname, task := range config.Tasks {
 		if tname != name {
@@ -375,16 +461,122 @@ func httpDeleteTask(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// other tasks can't be left with dependsOn of deleted one
+	err := checkDependencies(newTasks)
+	if nil != err {
+		httpConflict(w, r, name, "dependsOn", err)
+		return
+	}
+
+	// exit task (or its scheduler)
+	if nil != task.eSignal {
+		close(task.eSignal)
+	}
+
 	config.Tasks = newTasks
 
 	aConfig.Store(config)
-	go saveConfig()
+	go saveConfig(httpTrigger(r))
 
 	_, _ = w.Write([]byte("ok"))
 }
 
+// httpUpdateTask replaces definition of existing task (PUT) or merges
+// JSON merge patch (RFC 7396) into it (PATCH)
+func httpUpdateTask(merge bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "id")
+		if nil == r.Body {
+			httpProblems(w, r, name, "", errors.New("task definition is required"))
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		r.Body.Close()
+
+		if nil != err {
+			log.Println("Error processing update task request:", err)
+			httpProblems(w, r, name, "", err)
+			return
+		}
+
+		configChangeLock.Lock()
+		defer configChangeLock.Unlock()
+
+		config := aConfig.Load()
+		old, ok := config.Tasks[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("task not found"))
+			return
+		}
+
+		if merge {
+			body, err = mergeTaskPatch(old, body)
+			if nil != err {
+				httpProblems(w, r, name, "", fmt.Errorf("invalid patch: %w", err))
+				return
+			}
+		}
+
+		task := newTask()
+		err = json.Unmarshal(body, task)
+		if nil != err {
+			httpProblems(w, r, name, "", fmt.Errorf("invalid task definition: %w", err))
+			return
+		}
+
+		task.name = name
+		if problems := task.validate(true); len(problems) > 0 {
+			httpProblems(w, r, name, "", problems)
+			return
+		}
+
+		action, err := updateTask(config, old, task, httpTrigger(r))
+		if nil != err {
+			httpProblems(w, r, name, "dependsOn", err)
+			return
+		}
+
+		render.JSON(w, r, taskUpdateResult{
+			Action: action,
+			Status: config.Tasks[name].GetStatus(),
+		})
+	}
+}
+
+// httpProblems responds with 400 and JSON list of problems, err can be
+// configProblems or any error related to field of task
+func httpProblems(w http.ResponseWriter, r *http.Request, name string,
+	field string, err error) {
+
+	writeProblems(w, r, http.StatusBadRequest, name, field, err)
+}
+
+// httpConflict responds with 409 and JSON list of problems, used when
+// request conflicts with other tasks
+func httpConflict(w http.ResponseWriter, r *http.Request, name string,
+	field string, err error) {
+
+	writeProblems(w, r, http.StatusConflict, name, field, err)
+}
+
+func writeProblems(w http.ResponseWriter, r *http.Request, status int,
+	name string, field string, err error) {
+
+	var problems configProblems
+	if !errors.As(err, &problems) {
+		problems = configProblems{{Task: name, Field: field, Message: err.Error()}}
+	}
+
+	render.Status(r, status)
+	render.JSON(w, r, map[string]configProblems{"errors": problems})
+}
+
 func httpCreateTask(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "id")
 	if nil == r.Body {
+		httpProblems(w, r, name, "", errors.New("task definition is required"))
 		return
 	}
 
@@ -393,22 +585,20 @@ func httpCreateTask(w http.ResponseWriter, r *http.Request) {
 
 	if nil != err {
 		log.Println("Error processing create task request:", err)
+		httpProblems(w, r, name, "", err)
 		return
 	}
 
-	name := chi.URLParam(r, "id")
-	if name == "" {
-		return
-	}
-
-	var task Task
-	err = json.Unmarshal(body, &task)
+	task := newTask()
+	err = json.Unmarshal(body, task)
 	if nil != err {
-		log.Println("Error processing create task request:", err)
+		httpProblems(w, r, name, "", fmt.Errorf("invalid task definition: %w", err))
 		return
 	}
 
-	if task.Command == "" {
+	task.name = name
+	if problems := task.validate(true); len(problems) > 0 {
+		httpProblems(w, r, name, "", problems)
 		return
 	}
 
@@ -419,7 +609,7 @@ func httpCreateTask(w http.ResponseWriter, r *http.Request) {
 	_, ok := config.Tasks[name]
 
 	if ok {
-		_, _ = w.Write([]byte("task just exist"))
+		httpConflict(w, r, name, "", errors.New("task just exist"))
 		return
 	}
 
@@ -429,27 +619,50 @@ func httpCreateTask(w http.ResponseWriter, r *http.Request) {
 		newTasks[name] = task
 	}
 	task.name = name
-	newTasks[name] = &task
+	newTasks[name] = task
+
+	err = checkDependencies(newTasks)
+	if nil != err {
+		httpProblems(w, r, name, "dependsOn", err)
+		return
+	}
 
 	config.Tasks = newTasks
 	aConfig.Store(config)
 
-	go saveConfig()
+	go saveConfig(httpTrigger(r))
 
 	if !task.OneTime {
 		tasksWg.Add(1)
 		go task.Loop(needExit, &tasksWg)
 		time.Sleep(time.Second)
+	} else {
+		_ = task.startSchedule(needExit)
 	}
 	render.JSON(w, r, task.GetStatus())
 }
 
+// formatBytes returns human readable size
+func formatBytes(size uint64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := uint64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
 // Template functions for the UI
 func loadTemplates() *template.Template {
 	// Create a new template with functions if needed
 	// P.S.: just for future to avoid looking for documentation later :)
 	tmpl := template.New("").Funcs(template.FuncMap{
 		// Add any custom template functions here
+		"bytes": formatBytes,
 	})
 
 	// Parse templates from embedded filesystem
@@ -544,12 +757,7 @@ func httpGetTaskLogBuffer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	task.logBufferMutex.RLock()
-	logBuffer := make([]string, len(task.logBuffer))
-	copy(logBuffer, task.logBuffer)
-	task.logBufferMutex.RUnlock()
-
-	render.JSON(w, r, logBuffer)
+	render.JSON(w, r, task.getLogBuffer())
 }
 
 // Add new API endpoint to get config info
@@ -560,3 +768,44 @@ func httpGetConfigInfo(w http.ResponseWriter, r *http.Request) {
 	}
 	render.JSON(w, r, configInfo)
 }
+
+// httpGetTaskRuns returns history of one-time task runs, newest first
+func httpGetTaskRuns(w http.ResponseWriter, r *http.Request) {
+	task := getTask(w, r, true)
+	if task == nil {
+		return
+	}
+
+	render.JSON(w, r, task.getRuns())
+}
+
+// httpGetTaskRun returns one run from history with its output
+func httpGetTaskRun(w http.ResponseWriter, r *http.Request) {
+	task := getTask(w, r, true)
+	if task == nil {
+		return
+	}
+
+	record, ok := task.getRun(chi.URLParam(r, "runID"))
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("run not found"))
+		return
+	}
+
+	result := struct {
+		runRecord
+		Log string `json:"log"`
+	}{runRecord: record}
+
+	if record.Output != "" {
+		f, err := os.Open(record.Output)
+		if nil == err {
+			data, _ := io.ReadAll(io.LimitReader(f, runCaptureLimit))
+			f.Close()
+			result.Log = string(data)
+		}
+	}
+
+	render.JSON(w, r, result)
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// checkInstances validates number of instances of task
+func (t *Task) checkInstances() error {
+	if t.Instances < 0 {
+		return errors.New("number of instances can't be negative")
+	}
+	if t.Instances > 1 && t.OneTime {
+		return errors.New("instances are supported only for persistent tasks")
+	}
+	return nil
+}
+
+// getInstances returns instances of task if it has more than one
+func (t *Task) getInstances() []*Task {
+	instances, _ := t.instances.Load().([]*Task)
+	return instances
+}
+
+// newInstance creates copy of task definition for instance with given index,
+// {{.Index}} and $MINISV_INSTANCE in args, env and probes are replaced
+// with index, which is also passed in MINISV_INSTANCE env variable
+func (t *Task) newInstance(index int) (*Task, error) {
+	data, err := json.Marshal(t)
+	if nil != err {
+		return nil, err
+	}
+
+	inst := newTask()
+	err = json.Unmarshal(data, inst)
+	if nil != err {
+		return nil, err
+	}
+
+	idx := strconv.Itoa(index)
+	r := strings.NewReplacer("{{.Index}}", idx,
+		"${MINISV_INSTANCE}", idx, "$MINISV_INSTANCE", idx)
+
+	for i := range inst.Args {
+		inst.Args[i] = r.Replace(inst.Args[i])
+	}
+
+	env := make(map[string]string, len(inst.Env)+1)
+	for key, value := range inst.Env {
+		env[key] = r.Replace(value)
+	}
+	env["MINISV_INSTANCE"] = idx
+	inst.Env = env
+
+	// probes usually differ in port of instance
+	probes := []*probeConfig{}
+	if nil != inst.HealthCheck {
+		probes = append(probes, &inst.HealthCheck.probeConfig)
+	}
+	if nil != inst.Readiness {
+		probes = append(probes, &inst.Readiness.probeConfig)
+	}
+	for _, p := range probes {
+		p.URL = r.Replace(p.URL)
+		p.Address = r.Replace(p.Address)
+		for i := range p.Args {
+			p.Args[i] = r.Replace(p.Args[i])
+		}
+	}
+
+	inst.Instances = 0
+	inst.name = fmt.Sprintf("%s.%d", t.name, index)
+	inst.restartDone = make(chan bool, 1)
+	inst.initChannels()
+
+	return inst, nil
+}
+
+// instancesLoop runs all instances of task and forwards signals to them,
+// graceful restart is done one instance at a time
+func (t *Task) instancesLoop(cExit chan bool) {
+	instances := make([]*Task, 0, t.Instances)
+	for i := 0; i < t.Instances; i++ {
+		inst, err := t.newInstance(i)
+		if nil != err {
+			log.Printf("Error creating instance %d of task %s: %v\n", i, t.name, err)
+			t.setState(StateStartFailed, err)
+			return
+		}
+		instances = append(instances, inst)
+	}
+	t.instances.Store(instances)
+
+	if len(t.Listen) > 0 {
+		t.sockets = &listenSockets{}
+		defer t.sockets.close()
+	}
+	for _, inst := range instances {
+		inst.sockets = t.sockets
+	}
+
+	instExit := make(chan bool)
+	wg := sync.WaitGroup{}
+	for _, inst := range instances {
+		wg.Add(1)
+		go inst.Loop(instExit, &wg)
+	}
+
+	for {
+		select {
+		case sig := <-t.cSignal:
+			for _, inst := range instances {
+				select {
+				case inst.cSignal <- sig:
+				default:
+				}
+			}
+
+		case <-t.sSignal:
+			for _, inst := range instances {
+				select {
+				case inst.sSignal <- true:
+				default:
+				}
+			}
+
+		case <-t.fSignal:
+			for _, inst := range instances {
+				select {
+				case inst.fSignal <- true:
+				default:
+				}
+			}
+
+		case <-t.rSignal:
+			t.rollingRestart(instances, cExit, false)
+
+		case <-t.uSignal:
+			def := t.update.Swap(nil)
+			if nil == def {
+				continue
+			}
+			// instances get new definition from new version of task
+			restart := processChanged(t, def)
+			t = def
+			if !restart {
+				t.updateInstances(instances, cExit)
+				continue
+			}
+			t.rollingRestart(instances, cExit, true)
+
+		case <-cExit:
+			t.waitDependents(log.Writer())
+			close(instExit)
+			wg.Wait()
+			return
+
+		case <-t.eSignal:
+			for _, inst := range instances {
+				close(inst.eSignal)
+			}
+			wg.Wait()
+			return
+		}
+	}
+}
+
+// rollingRestart restarts instances one by one, waiting for end of restart
+// of each one before next, stops on minisv exit or task deletion;
+// with update instances get new definition of process from task
+func (t *Task) rollingRestart(instances []*Task, cExit chan bool, update bool) {
+	reason := t.takeRestartReason("restart requested")
+
+	for i, inst := range instances {
+		log.Printf("Restarting instance %d of %d of task %s\n",
+			i+1, len(instances), t.name)
+
+		// drop result of restart not requested by us (health check)
+		select {
+		case <-inst.restartDone:
+		default:
+		}
+
+		signal := inst.rSignal
+		if update {
+			def, err := t.newInstance(i)
+			if nil != err {
+				log.Printf("Error updating instance %d of task %s: %v\n", i, t.name, err)
+				continue
+			}
+			def.taskRuntime = inst.taskRuntime
+			inst.update.Store(def)
+			signal = inst.uSignal
+		} else {
+			inst.requestRestartReason(reason)
+		}
+
+		select {
+		case signal <- true:
+		case <-cExit:
+			return
+		case <-t.eSignal:
+			return
+		}
+
+		select {
+		case <-inst.restartDone:
+		case <-cExit:
+			return
+		case <-t.eSignal:
+			return
+		}
+	}
+}
+
+// updateInstances passes new restart settings from task to running
+// instances, which apply them without restart
+func (t *Task) updateInstances(instances []*Task, cExit chan bool) {
+	for i, inst := range instances {
+		def, err := t.newInstance(i)
+		if nil != err {
+			log.Printf("Error updating instance %d of task %s: %v\n", i, t.name, err)
+			continue
+		}
+		def.taskRuntime = inst.taskRuntime
+		inst.update.Store(def)
+
+		select {
+		case inst.uSignal <- true:
+		case <-cExit:
+			return
+		case <-t.eSignal:
+			return
+		}
+	}
+}
+
+// notifyRestartDone informs instances coordinator about finished restart
+func (t *Task) notifyRestartDone() {
+	if nil == t.restartDone {
+		return
+	}
+	select {
+	case t.restartDone <- true:
+	default:
+	}
+}
+
+// instancesState returns aggregated state: started if all instances are
+// running, degraded if only some of them
+func instancesState(instances []*Task) TaskState {
+	running := 0
+	for _, inst := range instances {
+		if inst.getState().Running() {
+			running++
+		}
+	}
+
+	switch {
+	case running == len(instances):
+		return StateStarted
+	case running > 0:
+		return StateDegraded
+	}
+	return instances[0].getState()
+}
+
+// instancesHealth returns healthy only if all instances are healthy
+func instancesHealth(instances []*Task) string {
+	healthy := 0
+	for _, inst := range instances {
+		health, _ := inst.health.Load().(string)
+		if health == "unhealthy" {
+			return health
+		}
+		if health == "healthy" {
+			healthy++
+		}
+	}
+	if healthy == len(instances) {
+		return "healthy"
+	}
+	return ""
+}
+
+// instancesStatus returns aggregated status with status of every instance
+func instancesStatus(instances []*Task) TaskStatus {
+	result := TaskStatus{
+		Status: instancesState(instances),
+		Health: instancesHealth(instances),
+	}
+
+	for i, inst := range instances {
+		status := inst.GetStatus()
+		result.Instances = append(result.Instances, status)
+
+		result.Running = result.Running || status.Running
+		result.PIDs = append(result.PIDs, status.PIDs...)
+		result.Restarts += status.Restarts
+		result.CPUUsage += status.CPUUsage
+		result.MemoryUsage += status.MemoryUsage
+
+		if result.Error == "" && status.Error != "" {
+			result.Error = fmt.Sprintf("instance %d: %s", i, status.Error)
+		}
+		if result.Started.IsZero() || status.Started.Before(result.Started) {
+			result.Started = status.Started
+		}
+		if status.Finished.After(result.Finished) {
+			result.Finished = status.Finished
+		}
+		if nil != status.LastExit &&
+			(nil == result.LastExit || status.LastExit.Time.After(result.LastExit.Time)) {
+			result.LastExit = status.LastExit
+			result.LastRestartReason = status.LastRestartReason
+		}
+	}
+
+	return result
+}
+
+// getLogBuffer returns last log lines, for task with instances lines
+// of all instances prefixed with instance index
+func (t *Task) getLogBuffer() []string {
+	if instances := t.getInstances(); len(instances) > 0 {
+		result := []string{}
+		for i, inst := range instances {
+			for _, line := range inst.getLogBuffer() {
+				result = append(result, fmt.Sprintf("[%d] %s", i, line))
+			}
+		}
+		return result
+	}
+
+	t.logBufferMutex.RLock()
+	defer t.logBufferMutex.RUnlock()
+
+	logBuffer := make([]string, len(t.logBuffer))
+	copy(logBuffer, t.logBuffer)
+	return logBuffer
+}
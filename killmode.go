@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// possible values of killMode
+const (
+	killModeProcess = "process" // only main process (default)
+	killModeGroup   = "group"   // process group of main process
+	killModeCgroup  = "cgroup"  // all processes in own cgroup
+)
+
+// checkKillMode validates killMode of task
+func (t *Task) checkKillMode() error {
+	switch t.KillMode {
+	case "", killModeProcess, killModeGroup:
+		return nil
+	case killModeCgroup:
+		return cgroupSupported()
+	}
+	return fmt.Errorf("unknown kill mode \"%s\"", t.KillMode)
+}
+
+// startCmd starts prepared command, in cgroup kill mode or with cgroup
+// limits process is placed into own cgroup of slot (0 - cmd1, 1 - cmd2)
+func (t *Task) startCmd(cmd *exec.Cmd, slot int) error {
+	if t.usesCgroup() {
+		return t.startInCgroup(cmd, slot)
+	}
+	return startProcess(cmd)
+}
+
+// signalChild sends signal to process, its group or all processes
+// of its cgroup depending on killMode of task
+func (t *Task) signalChild(cmd *exec.Cmd, slot int, sig os.Signal) error {
+	switch t.KillMode {
+	case killModeGroup:
+		if s, ok := sig.(syscall.Signal); ok {
+			return syscall.Kill(-cmd.Process.Pid, s)
+		}
+	case killModeCgroup:
+		return t.signalCgroup(slot, sig)
+	}
+	return cmd.Process.Signal(sig)
+}
+
+// killRest kills processes left in group or cgroup after exit of main one
+func (t *Task) killRest(cmd *exec.Cmd, slot int, out io.Writer) {
+	switch t.KillMode {
+	case killModeGroup:
+		err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		if nil == err {
+			fmt.Fprintln(out, "[minisv] Killed remaining processes of group",
+				cmd.Process.Pid)
+		} else if !errors.Is(err, syscall.ESRCH) {
+			fmt.Fprintln(out, "[minisv] Error killing process group: ", err)
+		}
+	case killModeCgroup:
+		t.cleanCgroup(slot, out, true)
+	default:
+		if t.usesCgroup() {
+			t.cleanCgroup(slot, out, false)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const (
+	// env variable marking that minisv is started as helper which sets
+	// LISTEN_PID and replaces itself with real command
+	listenExecEnv = "MINISV_LISTEN_EXEC"
+	// first passed descriptor as in sd_listen_fds
+	listenFdsStart = 3
+)
+
+// listenConfig describes socket opened by minisv and passed to task
+type listenConfig struct {
+	Name    string `json:"name,omitempty"`    // for LISTEN_FDNAMES, task name by default
+	Network string `json:"network,omitempty"` // tcp (default), tcp4, tcp6, udp, udp4, udp6 or unix
+	Address string `json:"address"`
+}
+
+// listenSockets are sockets opened once and passed to every process of task
+// (or all its instances), so new process during graceful restart accepts
+// connections from the same sockets as the old one
+type listenSockets struct {
+	sync.Mutex
+	files []*os.File
+	names []string
+}
+
+// checkListen validates listen sockets of task
+func (t *Task) checkListen() error {
+	if len(t.Listen) > 0 && t.OneTime {
+		return errors.New("listen is supported only for persistent tasks")
+	}
+	for _, l := range t.Listen {
+		switch l.Network {
+		case "", "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6", "unix":
+		default:
+			return fmt.Errorf("unsupported network \"%s\"", l.Network)
+		}
+		if l.Address == "" {
+			return errors.New("empty listen address")
+		}
+		if strings.Contains(l.Name, ":") {
+			return fmt.Errorf("name \"%s\" can't contain \":\"", l.Name)
+		}
+	}
+	return nil
+}
+
+// openSocket opens one socket and returns its file descriptor
+func openSocket(l listenConfig) (*os.File, error) {
+	network := l.Network
+	if network == "" {
+		network = "tcp"
+	}
+
+	switch network {
+	case "udp", "udp4", "udp6":
+		conn, err := net.ListenPacket(network, l.Address)
+		if nil != err {
+			return nil, err
+		}
+		defer conn.Close()
+		return conn.(*net.UDPConn).File()
+
+	case "unix":
+		// remove socket left from previous run
+		if fi, err := os.Stat(l.Address); nil == err && fi.Mode()&os.ModeSocket != 0 {
+			_ = os.Remove(l.Address)
+		}
+		listener, err := net.Listen(network, l.Address)
+		if nil != err {
+			return nil, err
+		}
+		unixListener := listener.(*net.UnixListener)
+		unixListener.SetUnlinkOnClose(false)
+		defer unixListener.Close()
+		return unixListener.File()
+	}
+
+	listener, err := net.Listen(network, l.Address)
+	if nil != err {
+		return nil, err
+	}
+	defer listener.Close()
+	return listener.(*net.TCPListener).File()
+}
+
+// get returns opened sockets with their names, sockets are opened
+// on first call
+func (s *listenSockets) get(t *Task) ([]*os.File, []string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if nil != s.files {
+		return s.files, s.names, nil
+	}
+
+	files := []*os.File{}
+	names := []string{}
+	for _, l := range t.Listen {
+		f, err := openSocket(l)
+		if nil != err {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, nil, fmt.Errorf("unable to listen on %s: %w", l.Address, err)
+		}
+		files = append(files, f)
+
+		name := l.Name
+		if name == "" {
+			name = t.name
+		}
+		names = append(names, name)
+	}
+
+	s.files, s.names = files, names
+	return s.files, s.names, nil
+}
+
+// close closes all opened sockets
+func (s *listenSockets) close() {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, f := range s.files {
+		f.Close()
+	}
+	s.files, s.names = nil, nil
+}
+
+// listenExec is executed instead of minisv main in helper process started
+// with listen sockets: LISTEN_PID should contain pid of final process,
+// which is known only in child, so helper sets it and execs real command
+// (os.Args[1] is path, os.Args[2:] are its arguments including argv[0])
+func listenExec() {
+	env := []string{}
+	for _, e := range os.Environ() {
+		if !strings.HasPrefix(e, listenExecEnv+"=") {
+			env = append(env, e)
+		}
+	}
+	env = append(env, "LISTEN_PID="+strconv.Itoa(os.Getpid()))
+
+	if len(os.Args) < 3 {
+		fmt.Fprintln(os.Stderr, "[minisv] Invalid arguments of listen helper")
+		os.Exit(127)
+	}
+
+	err := syscall.Exec(os.Args[1], os.Args[2:], env)
+	fmt.Fprintln(os.Stderr, "[minisv] Error executing", os.Args[1], ":", err)
+	os.Exit(127)
+}
@@ -23,7 +23,15 @@ var (
 
 func main() {
 
+	// helper process for task with listen sockets
+	if os.Getenv(listenExecEnv) != "" {
+		listenExec()
+	}
+
 	version := flag.Bool("version", false, "print minisv version")
+	check := flag.Bool("check", false, "validate config file, print all problems and exit")
+	initMode := flag.Bool("init", false,
+		"run as init: reap orphaned processes as child subreaper (default if pid is 1)")
 	flag.Parse()
 
 	if *version {
@@ -31,6 +39,10 @@ func main() {
 		os.Exit(0)
 	}
 
+	if *check {
+		os.Exit(checkConfig())
+	}
+
 	if !readConfig() {
 		return
 	}
@@ -43,10 +55,17 @@ func main() {
 
 	processRLimits(config.Limits)
 
+	if *initMode || os.Getpid() == 1 {
+		*initMode = true
+		startReaper()
+	}
+
 	for _, task := range config.Tasks {
 		if !task.OneTime {
 			tasksWg.Add(1)
 			go task.Loop(needExit, &tasksWg)
+		} else {
+			_ = task.startSchedule(needExit) // schedule was checked in readConfig
 		}
 	}
 
@@ -56,17 +75,24 @@ func main() {
 	go rotateOnHUP()
 	go rotateEveryPeriod()
 
+	// config reload on USR2 (HUP is used for log rotation)
+	go reloadOnUSR2()
+
 	exitChan := make(chan os.Signal, 1)
 	signal.Notify(exitChan, syscall.SIGTERM)
 	signal.Notify(exitChan, syscall.SIGINT)
 
 	log.Println("Running...")
 
-	<-exitChan
+	sig := <-exitChan
 
 	log.Println("Exiting...")
 
 	close(needExit)
 	tasksWg.Wait()
 
+	if *initMode {
+		stopOrphans(sig)
+	}
+
 }
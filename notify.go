@@ -0,0 +1,271 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultNotifyReadyTimeout = 90 * time.Second
+	notifyMessageSize         = 4096
+)
+
+var (
+	notifyDir     string
+	notifyDirErr  error
+	notifyDirOnce sync.Once
+)
+
+// notifier receives sd_notify messages from processes of task
+type notifier struct {
+	sync.Mutex
+	conn     *net.UnixConn
+	path     string
+	ready    map[int]time.Time // last READY=1 by sender pid (0 if unknown)
+	updated  chan bool         // closed and replaced on every READY=1
+	status   string            // last STATUS=
+	lastPing time.Time         // last WATCHDOG=1
+}
+
+// checkNotify validates notify settings of task
+func (t *Task) checkNotify() error {
+	if t.Watchdog < 0 {
+		return errors.New("watchdog interval can't be negative")
+	}
+	if t.Watchdog > 0 && t.Watchdog < configDuration(time.Second) {
+		return errors.New("watchdog interval should be at least 1s")
+	}
+	return nil
+}
+
+// getNotifyDir creates directory for notify sockets of all tasks
+func getNotifyDir() (string, error) {
+	notifyDirOnce.Do(func() {
+		notifyDir, notifyDirErr = os.MkdirTemp("", "minisv-notify-")
+		if nil == notifyDirErr {
+			// tasks running as other users should be able to reach sockets
+			notifyDirErr = os.Chmod(notifyDir, 0755)
+		}
+	})
+	return notifyDir, notifyDirErr
+}
+
+// newNotifier creates NOTIFY_SOCKET of task and starts reading from it
+func (t *Task) newNotifier(out io.Writer) (*notifier, error) {
+	dir, err := getNotifyDir()
+	if nil != err {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, strings.ReplaceAll(t.name, "/", "_")+".sock")
+	_ = os.Remove(path)
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if nil != err {
+		return nil, err
+	}
+	err = os.Chmod(path, 0666)
+	if nil == err {
+		err = enableCredentials(conn)
+	}
+	if nil != err {
+		conn.Close()
+		return nil, err
+	}
+
+	n := &notifier{
+		conn:    conn,
+		path:    path,
+		ready:   map[int]time.Time{},
+		updated: make(chan bool),
+	}
+	go t.notifyLoop(n, out)
+
+	return n, nil
+}
+
+// close stops reading and removes socket
+func (n *notifier) close() {
+	n.conn.Close()
+	_ = os.Remove(n.path)
+}
+
+// readySince returns true if READY=1 was received since given time
+// from any process except excluded one (old instance during restart)
+func (n *notifier) readySince(since time.Time, exclude int) (bool, chan bool) {
+	n.Lock()
+	defer n.Unlock()
+
+	for pid, at := range n.ready {
+		if (pid != exclude || pid == 0) && !at.Before(since) {
+			return true, n.updated
+		}
+	}
+	return false, n.updated
+}
+
+// notifyLoop reads and handles messages until socket is closed
+func (t *Task) notifyLoop(n *notifier, out io.Writer) {
+	buf := make([]byte, notifyMessageSize)
+	oob := make([]byte, notifyMessageSize)
+
+	for {
+		size, oobSize, _, _, err := n.conn.ReadMsgUnix(buf, oob)
+		if nil != err {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("Error reading notify socket of task %s: %v\n", t.name, err)
+			}
+			return
+		}
+		t.handleNotify(n, senderPid(oob[:oobSize]), string(buf[:size]), out)
+	}
+}
+
+// handleNotify processes one message (newline separated assignments)
+func (t *Task) handleNotify(n *notifier, pid int, message string, out io.Writer) {
+	// state changes are accepted from main process only, but pid can be
+	// unknown or be pid of its child, so just ignore other instance
+	t.info.Lock()
+	other := t.info.pids[1-t.info.main]
+	t.info.Unlock()
+	fromMain := pid == 0 || pid != other
+
+	for _, line := range strings.Split(message, "\n") {
+		key, value, _ := strings.Cut(line, "=")
+		switch key {
+		case "READY":
+			if value != "1" {
+				continue
+			}
+			started, _ := t.timeStarted.Load().(time.Time)
+			n.Lock()
+			// only notifications since last start are checked (readySince)
+			for p, at := range n.ready {
+				if at.Before(started) {
+					delete(n.ready, p)
+				}
+			}
+			n.ready[pid] = time.Now()
+			close(n.updated)
+			n.updated = make(chan bool)
+			n.Unlock()
+
+			if fromMain && (t.compareAndSetState(StateStarting, StateStarted) ||
+				t.compareAndSetState(StateReloading, StateStarted)) {
+				fmt.Fprintln(out, "[minisv] Task is ready")
+			}
+
+		case "RELOADING":
+			if value == "1" && fromMain {
+				t.compareAndSetState(StateStarted, StateReloading)
+			}
+
+		case "STOPPING":
+			if value == "1" && fromMain {
+				fmt.Fprintln(out, "[minisv] Task is stopping")
+			}
+
+		case "STATUS":
+			if fromMain {
+				n.Lock()
+				n.status = value
+				n.Unlock()
+			}
+
+		case "WATCHDOG":
+			if value == "1" {
+				n.Lock()
+				n.lastPing = time.Now()
+				n.Unlock()
+			}
+		}
+	}
+}
+
+// getNotifyStatus returns last STATUS= text of task
+func (t *Task) getNotifyStatus() string {
+	n := t.notify.Load()
+	if nil == n {
+		return ""
+	}
+	n.Lock()
+	defer n.Unlock()
+	return n.status
+}
+
+// waitNotifyReady waits for READY=1 from new instance (any process except
+// old one) sent after start, exit of new instance is reported via done
+func (t *Task) waitNotifyReady(started time.Time, old int, done chan error) error {
+	n := t.notify.Load()
+	if nil == n {
+		return errors.New("notify socket is not available")
+	}
+
+	timeout := defaultNotifyReadyTimeout
+	if nil != t.Readiness {
+		timeout = t.Readiness.deadline()
+	}
+	deadline := time.After(timeout)
+
+	for {
+		ready, updated := n.readySince(started, old)
+		if ready {
+			return nil
+		}
+
+		select {
+		case <-done:
+			return errNewInstanceExited
+		case <-deadline:
+			return fmt.Errorf("no READY=1 notification in %v", timeout)
+		case <-updated:
+		}
+	}
+}
+
+// watchdogLoop requests restart if main process doesn't send WATCHDOG=1
+// within watchdog interval
+func (t *Task) watchdogLoop(n *notifier, out io.Writer, stop chan bool) {
+	interval := time.Duration(t.Watchdog)
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		state := t.getState()
+		if !state.Running() || state == StateRestartValidation {
+			continue
+		}
+
+		n.Lock()
+		last := n.lastPing
+		n.Unlock()
+		if started, ok := t.timeStarted.Load().(time.Time); ok && started.After(last) {
+			last = started
+		}
+		if time.Since(last) < interval {
+			continue
+		}
+
+		fmt.Fprintf(out, "[minisv] No watchdog ping in %v, restarting\n", interval)
+		t.requestRestartReason("watchdog timeout")
+		select {
+		case t.rSignal <- true:
+		case <-stop:
+			return
+		}
+	}
+}
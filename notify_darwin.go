@@ -0,0 +1,11 @@
+package main
+
+import "net"
+
+func enableCredentials(conn *net.UnixConn) error {
+	return nil
+}
+
+func senderPid(oob []byte) int {
+	return 0
+}
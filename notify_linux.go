@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// enableCredentials turns on SO_PASSCRED, so every message has sender pid
+func enableCredentials(conn *net.UnixConn) error {
+	raw, err := conn.SyscallConn()
+	if nil != err {
+		return err
+	}
+
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_PASSCRED, 1)
+	})
+	if nil != err {
+		return err
+	}
+	return sockErr
+}
+
+// senderPid returns pid from credentials in control message or 0
+func senderPid(oob []byte) int {
+	messages, err := syscall.ParseSocketControlMessage(oob)
+	if nil != err {
+		return 0
+	}
+	for _, m := range messages {
+		cred, err := syscall.ParseUnixCredentials(&m)
+		if nil == err {
+			return int(cred.Pid)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// io scheduling classes for ioClass
+var ioClasses = map[string]int{
+	"none":        0,
+	"realtime":    1,
+	"best-effort": 2,
+	"idle":        3,
+}
+
+// PriorityStatus contains effective scheduling settings of process
+type PriorityStatus struct {
+	Nice        int    `json:"nice"`
+	IOClass     string `json:"ioClass"`
+	IOPriority  int    `json:"ioPriority"`
+	CPUAffinity string `json:"cpuAffinity,omitempty"`
+	OOMScoreAdj int    `json:"oomScoreAdj"`
+}
+
+// parseCPUList parses list of cpus like "0-3,6"
+func parseCPUList(list string) ([]int, error) {
+	cpus := []int{}
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+		a, b, isRange := strings.Cut(part, "-")
+		from, err := strconv.Atoi(a)
+		if nil != err || from < 0 {
+			return nil, fmt.Errorf("invalid cpu \"%s\"", part)
+		}
+		to := from
+		if isRange {
+			to, err = strconv.Atoi(b)
+			if nil != err || to < from {
+				return nil, fmt.Errorf("invalid cpu range \"%s\"", part)
+			}
+		}
+		for cpu := from; cpu <= to; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// formatCPUList returns list of cpus in the same format as parseCPUList accepts
+func formatCPUList(cpus []int) string {
+	sort.Ints(cpus)
+	parts := []string{}
+	for i := 0; i < len(cpus); {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(cpus[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", cpus[i], cpus[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// checkPriority validates scheduling settings of task
+func (t *Task) checkPriority() error {
+	if nil != t.Nice && (*t.Nice < -20 || *t.Nice > 19) {
+		return errors.New("nice should be in range -20..19")
+	}
+	if t.IOClass != "" {
+		if _, ok := ioClasses[t.IOClass]; !ok {
+			return fmt.Errorf("unknown ioClass \"%s\"", t.IOClass)
+		}
+	}
+	if nil != t.IOPriority && (*t.IOPriority < 0 || *t.IOPriority > 7) {
+		return errors.New("ioPriority should be in range 0..7")
+	}
+	if t.CPUAffinity != "" {
+		if _, err := parseCPUList(t.CPUAffinity); nil != err {
+			return fmt.Errorf("cpuAffinity: %w", err)
+		}
+	}
+	if nil != t.OOMScoreAdj && (*t.OOMScoreAdj < -1000 || *t.OOMScoreAdj > 1000) {
+		return errors.New("oomScoreAdj should be in range -1000..1000")
+	}
+	return nil
+}
+
+// applyPriority sets scheduling settings of task to just started process
+func (t *Task) applyPriority(pid int, out io.Writer) {
+	if nil != t.Nice {
+		if err := setNice(pid, *t.Nice); nil != err {
+			fmt.Fprintln(out, "[minisv] Error setting nice:", err)
+		}
+	}
+
+	if t.IOClass != "" || nil != t.IOPriority {
+		class := ioClasses["best-effort"]
+		if t.IOClass != "" {
+			class = ioClasses[t.IOClass]
+		}
+		priority := 4
+		if nil != t.IOPriority {
+			priority = *t.IOPriority
+		}
+		if err := setIOPriority(pid, class, priority); nil != err {
+			fmt.Fprintln(out, "[minisv] Error setting io priority:", err)
+		}
+	}
+
+	if t.CPUAffinity != "" {
+		cpus, _ := parseCPUList(t.CPUAffinity) // checked on config load
+		if err := setCPUAffinity(pid, cpus); nil != err {
+			fmt.Fprintln(out, "[minisv] Error setting cpu affinity:", err)
+		}
+	}
+
+	if nil != t.OOMScoreAdj {
+		if err := setOOMScoreAdj(pid, *t.OOMScoreAdj); nil != err {
+			fmt.Fprintln(out, "[minisv] Error setting oom score adj:", err)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+var (
+	errPriorityUnsupported = errors.New("supported only on linux")
+)
+
+func setNice(pid int, nice int) error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, pid, nice)
+}
+
+func setIOPriority(pid int, class int, priority int) error {
+	return errPriorityUnsupported
+}
+
+func setCPUAffinity(pid int, cpus []int) error {
+	return errPriorityUnsupported
+}
+
+func setOOMScoreAdj(pid int, score int) error {
+	return errPriorityUnsupported
+}
+
+func readPriority(pid int) *PriorityStatus {
+	prio, err := syscall.Getpriority(syscall.PRIO_PROCESS, pid)
+	if nil != err {
+		return nil
+	}
+	return &PriorityStatus{Nice: prio}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+	maxCPUs          = 1024
+)
+
+type cpuMask [maxCPUs / 64]uint64
+
+func setNice(pid int, nice int) error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, pid, nice)
+}
+
+func setIOPriority(pid int, class int, priority int) error {
+	_, _, errno := syscall.RawSyscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess,
+		uintptr(pid), uintptr(class<<ioprioClassShift|priority))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func setCPUAffinity(pid int, cpus []int) error {
+	var mask cpuMask
+	for _, cpu := range cpus {
+		if cpu >= maxCPUs {
+			return syscall.EINVAL
+		}
+		mask[cpu/64] |= 1 << uint(cpu%64)
+	}
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, uintptr(pid),
+		unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func setOOMScoreAdj(pid int, score int) error {
+	return os.WriteFile("/proc/"+strconv.Itoa(pid)+"/oom_score_adj",
+		[]byte(strconv.Itoa(score)), 0)
+}
+
+// readPriority returns effective scheduling settings of process
+func readPriority(pid int) *PriorityStatus {
+	result := &PriorityStatus{}
+
+	data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if nil != err {
+		return nil
+	}
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndexByte(stat, ')')+1:])
+	if len(fields) > 16 {
+		result.Nice, _ = strconv.Atoi(fields[16]) // field 19 of stat
+	}
+
+	ioprio, _, errno := syscall.RawSyscall(syscall.SYS_IOPRIO_GET,
+		ioprioWhoProcess, uintptr(pid), 0)
+	if errno == 0 {
+		class := int(ioprio >> ioprioClassShift)
+		result.IOPriority = int(ioprio & 0xff)
+		for name, id := range ioClasses {
+			if id == class {
+				result.IOClass = name
+			}
+		}
+	}
+
+	var mask cpuMask
+	_, _, errno = syscall.RawSyscall(syscall.SYS_SCHED_GETAFFINITY, uintptr(pid),
+		unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask)))
+	if errno == 0 {
+		cpus := []int{}
+		for cpu := 0; cpu < maxCPUs; cpu++ {
+			if mask[cpu/64]&(1<<uint(cpu%64)) != 0 {
+				cpus = append(cpus, cpu)
+			}
+		}
+		result.CPUAffinity = formatCPUList(cpus)
+	}
+
+	data, err = os.ReadFile("/proc/" + strconv.Itoa(pid) + "/oom_score_adj")
+	if nil == err {
+		result.OOMScoreAdj, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+	}
+
+	return result
+}
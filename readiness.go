@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultReadinessInterval = time.Second
+	defaultReadinessDeadline = 30 * time.Second
+)
+
+var (
+	errNewInstanceExited = errors.New("new instance exited")
+)
+
+// readinessConfig describes probe of new instance during graceful restart,
+// probe is repeated every interval until success or deadline
+type readinessConfig struct {
+	probeConfig
+	Interval configDuration `json:"interval,omitempty"` // default 1s
+	Deadline configDuration `json:"deadline,omitempty"` // default 30s
+}
+
+func (r *readinessConfig) interval() time.Duration {
+	if r.Interval <= 0 {
+		return defaultReadinessInterval
+	}
+	return time.Duration(r.Interval)
+}
+
+func (r *readinessConfig) deadline() time.Duration {
+	if r.Deadline <= 0 {
+		return defaultReadinessDeadline
+	}
+	return time.Duration(r.Deadline)
+}
+
+// checkReadiness validates readiness probe of task
+func (t *Task) checkReadiness() error {
+	if nil == t.Readiness {
+		return nil
+	}
+	if err := t.Readiness.checkType(); nil != err {
+		return err
+	}
+	// old instance is still listening on the same port during restart
+	if t.Readiness.Type != "exec" {
+		return fmt.Errorf("%s probe can be answered by old instance, "+
+			"use exec probe with MINISV_PID", t.Readiness.Type)
+	}
+	return nil
+}
+
+// waitNewInstance waits until new instance during graceful restart sends
+// READY=1 (for notify tasks) and passes readiness probe (if defined)
+func (t *Task) waitNewInstance(pid int, old int, started time.Time,
+	done chan error, out io.Writer) error {
+
+	if t.Notify {
+		fmt.Fprintln(out, "[minisv] Waiting for READY=1 from new instance")
+		err := t.waitNotifyReady(started, old, done)
+		if nil != err {
+			return err
+		}
+	}
+
+	if nil != t.Readiness {
+		return t.waitReady(t.Readiness, pid, done, out)
+	}
+	return nil
+}
+
+// waitReady probes new instance (exec probes get its pid in MINISV_PID)
+// until success, deadline or exit of process (reported via done channel)
+func (t *Task) waitReady(r *readinessConfig, pid int, done chan error,
+	out io.Writer) error {
+
+	deadline := time.After(r.deadline())
+	pidEnv := "MINISV_PID=" + strconv.Itoa(pid)
+
+	for {
+		err := t.probe(&r.probeConfig, pidEnv)
+		if nil == err {
+			return nil
+		}
+		fmt.Fprintln(out, "[minisv] New instance is not ready yet:", err)
+
+		select {
+		case <-done:
+			return errNewInstanceExited
+		case <-deadline:
+			return fmt.Errorf("not ready in %v: %w", r.deadline(), err)
+		case <-time.After(r.interval()):
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os/exec"
+	"sync"
+)
+
+// managed contains pids of processes started and waited by minisv itself,
+// reaper in init mode must not steal exit status of them from cmd.Wait
+var managed = struct {
+	sync.RWMutex // read lock is held while starting process
+	pids         sync.Map
+}{}
+
+// startProcess starts command and registers it as managed one
+func startProcess(cmd *exec.Cmd) error {
+	managed.RLock()
+	defer managed.RUnlock()
+
+	err := cmd.Start()
+	if nil == err {
+		managed.pids.Store(cmd.Process.Pid, true)
+	}
+	return err
+}
+
+// waitProcess waits for managed process exit
+func waitProcess(cmd *exec.Cmd) error {
+	err := cmd.Wait()
+	managed.pids.Delete(cmd.Process.Pid)
+	return err
+}
+
+// isManaged returns true if process was started by startProcess
+// and not waited yet
+func isManaged(pid int) bool {
+	_, ok := managed.pids.Load(pid)
+	return ok
+}
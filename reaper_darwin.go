@@ -0,0 +1,13 @@
+package main
+
+import (
+	"log"
+	"os"
+)
+
+func startReaper() {
+	log.Println("Init mode is supported only on linux")
+}
+
+func stopOrphans(sig os.Signal) {
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	prSetChildSubreaper = 36
+	orphansStopTimeout  = 5 * time.Second
+)
+
+// startReaper makes minisv subreaper of all descendants and reaps
+// orphaned processes re-parented to it
+func startReaper() {
+	_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, 1, 0)
+	if errno != 0 {
+		log.Println("Unable to become child subreaper: ", errno)
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGCHLD)
+
+	go func() {
+		for range sigChan {
+			reapOrphans()
+		}
+	}()
+
+	log.Println("Running in init mode")
+}
+
+// orphans returns not managed children of minisv: zombies and alive ones
+func orphans() (zombies []int, alive []int) {
+	me := os.Getpid()
+
+	entries, err := os.ReadDir("/proc")
+	if nil != err {
+		log.Println("Error reading /proc: ", err)
+		return nil, nil
+	}
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if nil != err || isManaged(pid) {
+			continue
+		}
+
+		data, err := os.ReadFile("/proc/" + entry.Name() + "/stat")
+		if nil != err {
+			continue
+		}
+		// comm can contain spaces and brackets, so fields after last ")"
+		stat := string(data)
+		fields := strings.Fields(stat[strings.LastIndexByte(stat, ')')+1:])
+		if len(fields) < 2 {
+			continue
+		}
+		ppid, _ := strconv.Atoi(fields[1])
+		if ppid != me {
+			continue
+		}
+
+		if fields[0] == "Z" {
+			zombies = append(zombies, pid)
+		} else {
+			alive = append(alive, pid)
+		}
+	}
+
+	return zombies, alive
+}
+
+// reapOrphans waits for all zombie children which are not managed,
+// write lock guarantees that process just started is already registered
+func reapOrphans() {
+	managed.Lock()
+	defer managed.Unlock()
+
+	zombies, _ := orphans()
+	for _, pid := range zombies {
+		var ws syscall.WaitStatus
+		wpid, err := syscall.Wait4(pid, &ws, syscall.WNOHANG, nil)
+		if nil != err || wpid != pid {
+			continue
+		}
+		if ws.Signaled() {
+			log.Printf("Reaped orphaned process %d, signal: %v\n", pid, ws.Signal())
+		} else {
+			log.Printf("Reaped orphaned process %d, exit code: %d\n", pid, ws.ExitStatus())
+		}
+	}
+}
+
+// stopOrphans forwards exit signal to processes left after all tasks are
+// finished and kills them after timeout
+func stopOrphans(sig os.Signal) {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		s = syscall.SIGTERM
+	}
+
+	reapOrphans()
+	_, alive := orphans()
+	if len(alive) == 0 {
+		return
+	}
+
+	log.Printf("Sending %v to orphaned processes %v\n", sig, alive)
+	for _, pid := range alive {
+		_ = syscall.Kill(pid, s)
+	}
+
+	deadline := time.Now().Add(orphansStopTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+		reapOrphans()
+		if _, alive = orphans(); len(alive) == 0 {
+			return
+		}
+	}
+
+	log.Printf("Killing orphaned processes %v\n", alive)
+	for _, pid := range alive {
+		_ = syscall.Kill(pid, syscall.SIGKILL)
+	}
+	time.Sleep(100 * time.Millisecond)
+	reapOrphans()
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"syscall"
+)
+
+// results of comparison of task versions (see compareTasks)
+const (
+	taskUnchanged = "unchanged"
+	taskUpdated   = "updated"   // restart settings or one-time task changed, no restart
+	taskRestarted = "restarted" // process definition changed, graceful restart
+	taskReplaced  = "replaced"  // other settings changed, stopped and started again
+)
+
+// reloadReport describes result of config reload
+type reloadReport struct {
+	Added     []string `json:"added"`
+	Removed   []string `json:"removed"`
+	Updated   []string `json:"updated"`
+	Restarted []string `json:"restarted"`
+	Replaced  []string `json:"replaced"`
+	Unchanged []string `json:"unchanged"`
+	Warnings  []string `json:"warnings,omitempty"`
+}
+
+// setProcessDefinition copies settings used on start and stop of process
+// from other version of task
+func (t *Task) setProcessDefinition(def *Task) {
+	t.Command = def.Command
+	t.Args = def.Args
+	t.WorkDir = def.WorkDir
+	t.Env = def.Env
+	t.EnvFiles = def.EnvFiles
+	t.ClearEnv = def.ClearEnv
+	t.User = def.User
+	t.Group = def.Group
+	t.SupplementaryGroups = def.SupplementaryGroups
+	t.Limits = def.Limits
+	t.Nice = def.Nice
+	t.IOClass = def.IOClass
+	t.IOPriority = def.IOPriority
+	t.CPUAffinity = def.CPUAffinity
+	t.OOMScoreAdj = def.OOMScoreAdj
+	t.Hooks = def.Hooks
+	t.StartTime = def.StartTime
+	t.Wait = def.Wait
+}
+
+// setRestartSettings copies settings which Loop uses after every exit
+// of process from other version of task
+func (t *Task) setRestartSettings(def *Task) {
+	t.Pause = def.Pause
+	t.RestartPolicy = def.RestartPolicy
+	t.Backoff = def.Backoff
+	t.CrashLoop = def.CrashLoop
+}
+
+// processChanged returns true if versions of task have different
+// definition of process (see setProcessDefinition)
+func processChanged(old *Task, new *Task) bool {
+	var oldProcess, newProcess Task
+	oldProcess.setProcessDefinition(old)
+	newProcess.setProcessDefinition(new)
+
+	oldData, err1 := json.Marshal(&oldProcess)
+	newData, err2 := json.Marshal(&newProcess)
+	return nil != err1 || nil != err2 || string(oldData) != string(newData)
+}
+
+// takeOver makes task new version of running old one (changed restart
+// settings or process only, or any changes of one-time task): task gets
+// state of old one and Loop switches to it (with graceful restart if process
+// is changed), scheduler of one-time task is restarted; published old
+// version is never changed
+func (t *Task) takeOver(old *Task) {
+	t.taskRuntime = old.taskRuntime
+
+	// running one-time task finishes with old version, next runs use new one
+	if t.OneTime {
+		if nil != t.eSignal {
+			close(t.eSignal)
+			t.eSignal = nil
+		}
+		_ = t.startSchedule(needExit)
+		return
+	}
+
+	t.update.Store(t)
+	go func() {
+		select {
+		case t.uSignal <- true:
+		case <-t.exitedChan():
+		}
+	}()
+}
+
+// compareTasks returns how new version of task can be applied: unchanged,
+// updated or restarted if new version can take over old one (see takeOver)
+// or replaced
+func compareTasks(old *Task, new *Task) (string, error) {
+	oldData, err := json.Marshal(old)
+	if nil != err {
+		return "", err
+	}
+	newData, err := json.Marshal(new)
+	if nil != err {
+		return "", err
+	}
+	if string(oldData) == string(newData) {
+		return taskUnchanged, nil
+	}
+	// every run of one-time task uses current version
+	if old.OneTime && new.OneTime {
+		return taskUpdated, nil
+	}
+
+	// new task with process definition and restart settings of old one
+	var probe Task
+	err = json.Unmarshal(newData, &probe)
+	if nil != err {
+		return "", err
+	}
+	probe.setProcessDefinition(old)
+	probe.setRestartSettings(old)
+	probeData, err := json.Marshal(&probe)
+	if nil != err {
+		return "", err
+	}
+
+	switch {
+	case string(oldData) != string(probeData):
+		return taskReplaced, nil
+	case processChanged(old, new):
+		return taskRestarted, nil
+	}
+	return taskUpdated, nil
+}
+
+// startTask starts loop of persistent task or scheduler of one-time one
+func startTask(task *Task) {
+	if !task.OneTime {
+		tasksWg.Add(1)
+		go task.Loop(needExit, &tasksWg)
+	} else {
+		_ = task.startSchedule(needExit)
+	}
+}
+
+// stopTask exits loop of task (or its scheduler) and waits for end of loop
+func stopTask(task *Task) {
+	if nil == task.eSignal {
+		return
+	}
+	close(task.eSignal)
+	if !task.OneTime {
+		<-task.exitedChan()
+	}
+}
+
+// reloadConfig re-reads config file, applies it and stores it in history,
+// trigger describes source of reload
+func reloadConfig(trigger string) (*reloadReport, error) {
+	config, data, err := loadConfig()
+	if nil != err {
+		return nil, err
+	}
+
+	report, err := applyConfig(config)
+	if nil != err {
+		return nil, err
+	}
+
+	recordConfigVersion(data, trigger)
+
+	return report, nil
+}
+
+// applyConfig applies difference between new and current config to running
+// tasks: new tasks are started, removed ones are stopped, tasks with changed
+// process definition are restarted gracefully and tasks with other changes
+// are stopped and started again
+func applyConfig(config *Config) (*reloadReport, error) {
+	configChangeLock.Lock()
+	defer configChangeLock.Unlock()
+
+	old := aConfig.Load()
+	report := &reloadReport{
+		Added:     []string{},
+		Removed:   []string{},
+		Updated:   []string{},
+		Restarted: []string{},
+		Replaced:  []string{},
+		Unchanged: []string{},
+	}
+
+	tasks := make(map[string]*Task, len(config.Tasks))
+	var toStop, toStart []*Task
+	updates := map[*Task]*Task{} // new version -> old one
+
+	for name, task := range config.Tasks {
+		oldTask, ok := old.Tasks[name]
+		if !ok {
+			report.Added = append(report.Added, name)
+			tasks[name] = task
+			toStart = append(toStart, task)
+			continue
+		}
+
+		action, err := compareTasks(oldTask, task)
+		if nil != err {
+			return nil, err
+		}
+
+		switch action {
+		case taskUnchanged:
+			report.Unchanged = append(report.Unchanged, name)
+			tasks[name] = oldTask
+		case taskUpdated:
+			report.Updated = append(report.Updated, name)
+			tasks[name] = task
+			updates[task] = oldTask
+		case taskRestarted:
+			report.Restarted = append(report.Restarted, name)
+			tasks[name] = task
+			updates[task] = oldTask
+		default:
+			report.Replaced = append(report.Replaced, name)
+			tasks[name] = task
+			toStop = append(toStop, oldTask)
+			toStart = append(toStart, task)
+		}
+	}
+
+	for name, task := range old.Tasks {
+		if _, ok := config.Tasks[name]; !ok {
+			report.Removed = append(report.Removed, name)
+			toStop = append(toStop, task)
+		}
+	}
+
+	// settings used only on start of minisv
+	if !reflect.DeepEqual(old.HTTP, config.HTTP) {
+		report.Warnings = append(report.Warnings,
+			"http settings are applied only after restart of http server (SIGUSR1)")
+	}
+	if !reflect.DeepEqual(old.Limits, config.Limits) {
+		report.Warnings = append(report.Warnings,
+			"limits of minisv are applied only on start")
+	}
+
+	// running outputs use the same graylog socket
+	if old.GrayLog.Remote == config.GrayLog.Remote {
+		if nil != config.GrayLog.socket {
+			config.GrayLog.socket.Close()
+		}
+		config.GrayLog.socket = old.GrayLog.socket
+	}
+
+	for _, task := range stopOrder(toStop) {
+		stopTask(task)
+	}
+
+	// new versions get state of running tasks before they are published
+	for task, oldTask := range updates {
+		task.takeOver(oldTask)
+	}
+
+	config.Tasks = tasks
+	aConfig.Store(config)
+
+	for _, task := range toStart {
+		startTask(task)
+	}
+
+	for _, list := range [][]string{report.Added, report.Removed, report.Updated,
+		report.Restarted, report.Replaced, report.Unchanged} {
+		sort.Strings(list)
+	}
+
+	log.Printf("Config applied: %d added, %d removed, %d updated, %d restarted, %d replaced\n",
+		len(report.Added), len(report.Removed), len(report.Updated),
+		len(report.Restarted), len(report.Replaced))
+
+	return report, nil
+}
+
+// reloadOnUSR2 reloads config on SIGUSR2
+func reloadOnUSR2() {
+	usr2Chan := make(chan os.Signal, 1)
+	signal.Notify(usr2Chan, syscall.SIGUSR2)
+	for range usr2Chan {
+		_, err := reloadConfig("SIGUSR2")
+		if nil != err {
+			log.Println("Error reloading config:", err)
+		}
+	}
+}
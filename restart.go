@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultBackoffMultiplier = 2.0
+	defaultBackoffMax        = time.Minute
+	defaultCrashLoopWindow   = time.Minute
+)
+
+// backoffConfig makes restart pause grow after every quick exit
+type backoffConfig struct {
+	Max        configDuration `json:"max,omitempty"`        // max pause, default 1m
+	Multiplier float64        `json:"multiplier,omitempty"` // default 2
+	Jitter     float64        `json:"jitter,omitempty"`     // random +/- part of pause, 0..1
+}
+
+// crashLoopConfig stops restarting of task which exits too often
+type crashLoopConfig struct {
+	MaxExits int            `json:"maxExits"`         // more exits in window means crash loop
+	Window   configDuration `json:"window,omitempty"` // default 1m
+}
+
+func (c *crashLoopConfig) window() time.Duration {
+	if c.Window <= 0 {
+		return defaultCrashLoopWindow
+	}
+	return time.Duration(c.Window)
+}
+
+// restartState keeps history of exits between restarts of task
+type restartState struct {
+	pause time.Duration // last used pause (for backoff)
+	exits []time.Time   // exit times inside crash loop window
+}
+
+func (rs *restartState) reset() {
+	rs.pause = 0
+	rs.exits = nil
+}
+
+// checkRestartPolicy validates restartPolicy of task
+func (t *Task) checkRestartPolicy() error {
+	switch t.RestartPolicy {
+	case "", "always", "on-failure", "never":
+		return nil
+	}
+	return fmt.Errorf("unknown restart policy \"%s\"", t.RestartPolicy)
+}
+
+// checkBackoff validates backoff settings of task
+func (t *Task) checkBackoff() error {
+	if nil == t.Backoff {
+		return nil
+	}
+	if t.Backoff.Jitter < 0 || t.Backoff.Jitter > 1 {
+		return fmt.Errorf("jitter %v is out of range 0..1", t.Backoff.Jitter)
+	}
+	return nil
+}
+
+// shouldRestart checks restart policy of task for exit error
+func (t *Task) shouldRestart(exitErr error) bool {
+	switch t.RestartPolicy {
+	case "never":
+		return false
+	case "on-failure":
+		return nil != exitErr
+	}
+	return true
+}
+
+// isCrashLoop records exit and returns true if task exited more than
+// crashLoop.maxExits times in crashLoop.window
+func (t *Task) isCrashLoop(rs *restartState, now time.Time) bool {
+	if nil == t.CrashLoop || t.CrashLoop.MaxExits <= 0 {
+		return false
+	}
+
+	window := t.CrashLoop.window()
+
+	exits := rs.exits[:0]
+	for _, exit := range rs.exits {
+		if now.Sub(exit) < window {
+			exits = append(exits, exit)
+		}
+	}
+	rs.exits = append(exits, now)
+
+	return len(rs.exits) > t.CrashLoop.MaxExits
+}
+
+// restartPause returns time to wait before next start, process which
+// was running longer than max backoff pause resets the backoff
+func (t *Task) restartPause(rs *restartState, uptime time.Duration) time.Duration {
+	base := time.Second * time.Duration(t.Pause)
+	if nil == t.Backoff {
+		return base
+	}
+
+	max := time.Duration(t.Backoff.Max)
+	if max <= 0 {
+		max = defaultBackoffMax
+	}
+	multiplier := t.Backoff.Multiplier
+	if multiplier < 1 {
+		multiplier = defaultBackoffMultiplier
+	}
+	if base <= 0 {
+		base = time.Second
+	}
+
+	if rs.pause == 0 || uptime >= max {
+		rs.pause = base
+	} else {
+		rs.pause = time.Duration(float64(rs.pause) * multiplier)
+		if rs.pause > max {
+			rs.pause = max
+		}
+	}
+
+	pause := rs.pause
+	if t.Backoff.Jitter > 0 {
+		jitter := float64(pause) * t.Backoff.Jitter
+		pause += time.Duration(jitter * (2*rand.Float64() - 1))
+	}
+
+	return pause
+}
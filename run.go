@@ -0,0 +1,56 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// max size of captured stdout/stderr of one run
+	runCaptureLimit = 1024 * 1024
+)
+
+// RunResult describes finished run of one-time task
+type RunResult struct {
+	RunID      string    `json:"runId"`
+	Status     TaskState `json:"status"`
+	ExitCode   int       `json:"exitCode"`
+	Signal     string    `json:"signal,omitempty"`
+	CoreDumped bool      `json:"coreDumped,omitempty"`
+	TimedOut   bool      `json:"timedOut,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Started    time.Time `json:"started"`
+	Finished   time.Time `json:"finished"`
+	Duration   float64   `json:"duration"` // in seconds
+	Stdout     string    `json:"stdout"`
+	Stderr     string    `json:"stderr"`
+	Truncated  bool      `json:"truncated,omitempty"`
+}
+
+// captureBuffer keeps first runCaptureLimit bytes of output
+type captureBuffer struct {
+	mu        sync.Mutex
+	data      []byte
+	truncated bool
+}
+
+func (b *captureBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	free := runCaptureLimit - len(b.data)
+	if len(p) > free {
+		b.data = append(b.data, p[:free]...)
+		b.truncated = true
+	} else {
+		b.data = append(b.data, p...)
+	}
+	// never fail, otherwise output of process would be broken
+	return len(p), nil
+}
+
+func (b *captureBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.data)
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errScheduleNotFound = errors.New("no matching time in next 5 years")
+)
+
+// schedule is parsed cron expression or fixed interval
+type schedule struct {
+	every                                 time.Duration // for @every, otherwise 0
+	second, minute, hour, dom, month, dow uint64        // bitmasks of allowed values
+	domStar, dowStar                      bool          // for standard dom/dow "or" logic
+}
+
+var scheduleMacros = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+var (
+	monthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4,
+		"may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10,
+		"nov": 11, "dec": 12}
+	dowNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3,
+		"thu": 4, "fri": 5, "sat": 6}
+)
+
+// parseSchedule accepts 5 fields (minute hour dom month dow) or 6 fields
+// (with seconds first) cron expressions, macros like @daily and "@every 10m"
+func parseSchedule(spec string) (*schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	if strings.HasPrefix(spec, "@every ") {
+		every, err := time.ParseDuration(strings.TrimSpace(spec[len("@every "):]))
+		if nil != err {
+			return nil, err
+		}
+		if every < time.Second {
+			return nil, fmt.Errorf("interval %v is less than 1s", every)
+		}
+		return &schedule{every: every}, nil
+	}
+
+	if macro, ok := scheduleMacros[spec]; ok {
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("expected 5 or 6 fields, got %d", len(fields))
+	}
+
+	s := &schedule{}
+	var err error
+
+	if s.second, err = parseCronField(fields[0], 0, 59, nil); nil != err {
+		return nil, fmt.Errorf("seconds: %w", err)
+	}
+	if s.minute, err = parseCronField(fields[1], 0, 59, nil); nil != err {
+		return nil, fmt.Errorf("minutes: %w", err)
+	}
+	if s.hour, err = parseCronField(fields[2], 0, 23, nil); nil != err {
+		return nil, fmt.Errorf("hours: %w", err)
+	}
+	if s.dom, err = parseCronField(fields[3], 1, 31, nil); nil != err {
+		return nil, fmt.Errorf("day of month: %w", err)
+	}
+	if s.month, err = parseCronField(fields[4], 1, 12, monthNames); nil != err {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	if s.dow, err = parseCronField(fields[5], 0, 7, dowNames); nil != err {
+		return nil, fmt.Errorf("day of week: %w", err)
+	}
+	// 7 is sunday too
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+
+	s.domStar = fields[3] == "*" || fields[3] == "?"
+	s.dowStar = fields[5] == "*" || fields[5] == "?"
+
+	return s, nil
+}
+
+// parseCronField parses comma separated list of values, ranges (a-b),
+// steps (*/n, a-b/n) and names into bitmask
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	var result uint64
+
+	value := func(s string) (int, error) {
+		if v, ok := names[strings.ToLower(s)]; ok {
+			return v, nil
+		}
+		v, err := strconv.Atoi(s)
+		if nil != err {
+			return 0, fmt.Errorf("invalid value \"%s\"", s)
+		}
+		if v < min || v > max {
+			return 0, fmt.Errorf("value %d out of range %d-%d", v, min, max)
+		}
+		return v, nil
+	}
+
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepStr)
+			if nil != err || step <= 0 {
+				return 0, fmt.Errorf("invalid step \"%s\"", stepStr)
+			}
+		}
+
+		var from, to int
+		switch {
+		case rng == "*" || rng == "?":
+			from, to = min, max
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err error
+			if from, err = value(a); nil != err {
+				return 0, err
+			}
+			if to, err = value(b); nil != err {
+				return 0, err
+			}
+			if from > to {
+				return 0, fmt.Errorf("invalid range \"%s\"", rng)
+			}
+		default:
+			v, err := value(rng)
+			if nil != err {
+				return 0, err
+			}
+			from, to = v, v
+			if hasStep {
+				to = max
+			}
+		}
+
+		for i := from; i <= to; i += step {
+			result |= 1 << uint(i)
+		}
+	}
+
+	return result, nil
+}
+
+// next returns first activation time after given one
+func (s *schedule) next(after time.Time) (time.Time, error) {
+	if s.every > 0 {
+		return after.Add(s.every), nil
+	}
+
+	t := after.Truncate(time.Second).Add(time.Second)
+	limit := after.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, t.Location())
+			continue
+		}
+		if s.second&(1<<uint(t.Second())) == 0 {
+			t = t.Add(time.Second)
+			continue
+		}
+		return t, nil
+	}
+
+	return time.Time{}, errScheduleNotFound
+}
+
+// dayMatches uses cron logic: if both day of month and day of week are
+// restricted, any of them should match
+func (s *schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// scheduleLoop runs one-time task according to its schedule
+// until minisv exit or task deletion (or update, closing stop)
+func (t *Task) scheduleLoop(s *schedule, cExit chan bool, stop chan bool) {
+	for {
+		now := time.Now()
+		next, err := s.next(now)
+		if nil != err {
+			log.Printf("Schedule of task %s: %v\n", t.name, err)
+			t.nextRun.Store(time.Time{})
+			return
+		}
+		t.nextRun.Store(next)
+
+		select {
+		case <-cExit:
+			return
+		case <-stop:
+			return
+		case <-time.After(time.Until(next)):
+		}
+
+		if !t.tryStartRun() {
+			log.Printf("Scheduled run of task %s skipped, it's still running\n", t.name)
+			continue
+		}
+		t.lastRun.Store(time.Now())
+		go t.Run(nil, "schedule", false)
+	}
+}
+
+// checkSchedule validates schedule of task
+func (t *Task) checkSchedule() error {
+	if t.Schedule == "" {
+		return nil
+	}
+	if !t.OneTime {
+		return errors.New("schedule is supported only for one-time tasks")
+	}
+	_, err := parseSchedule(t.Schedule)
+	return err
+}
+
+// startSchedule starts scheduler for one-time task with schedule
+func (t *Task) startSchedule(cExit chan bool) error {
+	if !t.OneTime || t.Schedule == "" {
+		return nil
+	}
+
+	s, err := parseSchedule(t.Schedule)
+	if nil != err {
+		return err
+	}
+
+	stop := make(chan bool)
+	t.eSignal = stop
+	go t.scheduleLoop(s, cExit, stop)
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// TaskState is state of task in its lifecycle
+type TaskState string
+
+// All possible task states
+const (
+	StateNotStarted        TaskState = "not started"
+	StateWaitingDeps       TaskState = "waiting for dependencies"
+	StateStarting          TaskState = "starting"
+	StateStarted           TaskState = "started" // persistent task is running
+	StateRunning           TaskState = "running" // one-time task is running
+	StateRestartValidation TaskState = "restart validation"
+	StateRestartOK         TaskState = "restart ok"
+	StateFinished          TaskState = "finished"
+	StateFailed            TaskState = "failed"
+	StateStartFailed       TaskState = "start failed"
+	StateTimedOut          TaskState = "timed out"
+	StateStopped           TaskState = "stopped"
+	StateCrashLoop         TaskState = "crash loop"
+	StateDegraded          TaskState = "degraded"  // only some of instances are running
+	StateReloading         TaskState = "reloading" // after RELOADING=1 notification
+)
+
+// Running returns true if process of task is alive in this state
+func (s TaskState) Running() bool {
+	return s == StateStarted || s == StateRunning ||
+		s == StateRestartValidation || s == StateRestartOK || s == StateDegraded ||
+		s == StateReloading
+}
+
+// ExitInfo describes how process ended
+type ExitInfo struct {
+	Code       int       `json:"code"` // -1 if terminated by signal
+	Signal     string    `json:"signal,omitempty"`
+	CoreDumped bool      `json:"coreDumped,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// newExitInfo fills exit details from error returned by cmd.Wait
+func newExitInfo(err error) *ExitInfo {
+	info := &ExitInfo{Time: time.Now()}
+	if nil == err {
+		return info
+	}
+
+	info.Error = err.Error()
+	info.Code = -1
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return info
+	}
+
+	if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		info.Signal = ws.Signal().String()
+		info.CoreDumped = ws.CoreDump()
+		return info
+	}
+
+	info.Code = exitErr.ExitCode()
+	return info
+}
+
+// processInfo keeps runtime details of task
+type processInfo struct {
+	sync.Mutex
+	state         TaskState
+	err           string    // error related to current state
+	pids          [2]int    // pids of processes in cmd1/cmd2 slots
+	main          int       // index of slot with main process
+	lastExit      *ExitInfo // exit of last main process
+	starts        int       // number of main process starts
+	restartReason string    // reason of last restart
+	pendingReason string    // reason for next restart requested via rSignal
+}
+
+// setState changes state of task, err is optional reason of it
+func (t *Task) setState(state TaskState, err error) {
+	t.info.Lock()
+	defer t.info.Unlock()
+
+	t.info.state = state
+	t.info.err = ""
+	if nil != err {
+		t.info.err = err.Error()
+	}
+}
+
+// compareAndSetState changes state only if current one is expected,
+// returns true if state was changed
+func (t *Task) compareAndSetState(expected TaskState, state TaskState) bool {
+	t.info.Lock()
+	defer t.info.Unlock()
+
+	if t.info.state != expected {
+		return false
+	}
+	t.info.state = state
+	t.info.err = ""
+	return true
+}
+
+// getState returns current state of task
+func (t *Task) getState() TaskState {
+	if instances := t.getInstances(); len(instances) > 0 {
+		return instancesState(instances)
+	}
+
+	t.info.Lock()
+	defer t.info.Unlock()
+
+	if t.info.state == "" {
+		return StateNotStarted
+	}
+	return t.info.state
+}
+
+// setPID stores pid of process in slot (0 - cmd1, 1 - cmd2), 0 for none
+func (t *Task) setPID(slot int, pid int) {
+	t.info.Lock()
+	defer t.info.Unlock()
+	t.info.pids[slot] = pid
+}
+
+// setMainSlot marks which slot contains main process
+func (t *Task) setMainSlot(slot int) {
+	t.info.Lock()
+	defer t.info.Unlock()
+	t.info.main = slot
+}
+
+// setExit records exit of main process
+func (t *Task) setExit(err error) {
+	info := newExitInfo(err)
+
+	t.info.Lock()
+	defer t.info.Unlock()
+	t.info.lastExit = info
+}
+
+// countStart increments start counter, every start except first one is
+// restart with given reason
+func (t *Task) countStart(reason string) {
+	t.info.Lock()
+	defer t.info.Unlock()
+
+	t.info.starts++
+	if t.info.starts > 1 {
+		t.info.restartReason = reason
+	}
+}
+
+// requestRestartReason sets reason for next restart requested using rSignal
+func (t *Task) requestRestartReason(reason string) {
+	t.info.Lock()
+	defer t.info.Unlock()
+	t.info.pendingReason = reason
+}
+
+// takeRestartReason returns reason of requested restart or default one
+func (t *Task) takeRestartReason(def string) string {
+	t.info.Lock()
+	defer t.info.Unlock()
+
+	reason := t.info.pendingReason
+	t.info.pendingReason = ""
+	if reason == "" {
+		return def
+	}
+	return reason
+}
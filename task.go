@@ -2,10 +2,14 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -21,60 +25,275 @@ type Task struct {
 	Pause     int      `json:"restartPause"`
 	StartTime int      `json:"startTime"`
 	OneTime   bool     `json:"oneTime"`
+	// environment of child process
+	Env      map[string]string `json:"env,omitempty"`
+	EnvFiles []string          `json:"envFiles,omitempty"`
+	ClearEnv bool              `json:"clearEnv,omitempty"`
+	// credentials of child process (names or numeric ids)
+	User                string   `json:"user,omitempty"`
+	Group               string   `json:"group,omitempty"`
+	SupplementaryGroups []string `json:"supplementaryGroups,omitempty"`
+	// active check of running process
+	HealthCheck *healthCheckConfig `json:"healthCheck,omitempty"`
+	// probe of new instance before old one is terminated on graceful restart
+	Readiness *readinessConfig `json:"readinessProbe,omitempty"`
+	// restart behaviour: "always" (default), "on-failure" or "never"
+	RestartPolicy string           `json:"restartPolicy,omitempty"`
+	Backoff       *backoffConfig   `json:"backoff,omitempty"`
+	CrashLoop     *crashLoopConfig `json:"crashLoop,omitempty"`
+	// tasks which must be ready (dependsOn) or just started (after) before
+	DependsOn []string `json:"dependsOn,omitempty"`
+	After     []string `json:"after,omitempty"`
+	// cron expression or "@every 1h" for periodic runs of one-time task
+	Schedule string `json:"schedule,omitempty"`
+	// max execution time of one-time task
+	Timeout configDuration `json:"timeout,omitempty"`
+	// which processes get signals: "process" (default), "group" or "cgroup"
+	KillMode string `json:"killMode,omitempty"`
+	// cgroup v2 limits, task is placed in own cgroup if set
+	Cgroup *cgroupConfig `json:"cgroup,omitempty"`
+	// resource limits of child process
+	Limits []configRLimit `json:"limits,omitempty"`
+	// scheduling of child process: nice (-20..19), ioClass ("realtime",
+	// "best-effort", "idle") with ioPriority (0..7), cpuAffinity (like "0-3,6")
+	// and oomScoreAdj (-1000..1000)
+	Nice        *int   `json:"nice,omitempty"`
+	IOClass     string `json:"ioClass,omitempty"`
+	IOPriority  *int   `json:"ioPriority,omitempty"`
+	CPUAffinity string `json:"cpuAffinity,omitempty"`
+	OOMScoreAdj *int   `json:"oomScoreAdj,omitempty"`
+	// number of processes, each one gets own index
+	Instances int `json:"instances,omitempty"`
+	// commands executed around start and stop of process
+	Hooks *hooksConfig `json:"hooks,omitempty"`
+	// sockets opened by minisv and passed to processes (systemd style)
+	Listen []listenConfig `json:"listen,omitempty"`
+	// sd_notify protocol: task is started only after READY=1 if notify
+	// is set, without WATCHDOG=1 during watchdog interval it's restarted
+	Notify   bool           `json:"notify,omitempty"`
+	Watchdog configDuration `json:"watchdog,omitempty"`
 	// hidden fields
-	stopped        bool           // indicate to don't restart after "die"
-	oneTimeRunning bool           // indicate that we're just running
-	oneTimeMutex   sync.Mutex     // mutex for oneTimeRunning
-	status         atomic.Value   // string like "none" (not started at all), "running", "finished", "restarting"
-	timeStarted    atomic.Value   // when task started (time.Time / nil)
-	timeFinished   atomic.Value   // last task finished time (time.Time / nil)
-	name           string         // duplicate name from config
-	cSignal        chan os.Signal // send signal to process
-	rSignal        chan bool      // restart signal
-	fSignal        chan bool      // log flush signal
-	sSignal        chan bool      // signal to stop task
-	eSignal        chan bool      // exit loop, trigered on task delete
-	logBuffer      []string       // buffer for last 10 log lines
-	logBufferMutex sync.RWMutex   // mutex for log buffer operations
+	name         string // duplicate name from config
+	*taskRuntime        // state of running task, shared with new version of definition
+}
+
+// taskRuntime is state of task, new version of definition with changes of
+// process only (see setProcessDefinition) gets it from old one, so running
+// processes, status and logs are kept
+type taskRuntime struct {
+	stopped        bool                     // indicate to don't restart after "die"
+	oneTimeRunning bool                     // indicate that we're just running
+	oneTimeMutex   sync.Mutex               // mutex for oneTimeRunning
+	info           processInfo              // state, pids and exit details
+	timeStarted    atomic.Value             // when task started (time.Time / nil)
+	timeFinished   atomic.Value             // last task finished time (time.Time / nil)
+	envApplied     atomic.Value             // masked task specific env from last start ([]string)
+	health         atomic.Value             // result of health checks: "", "healthy" or "unhealthy"
+	nextRun        atomic.Value             // next scheduled run (time.Time / nil)
+	lastRun        atomic.Value             // last scheduled run (time.Time / nil)
+	cSignal        chan os.Signal           // send signal to process
+	rSignal        chan bool                // restart signal
+	fSignal        chan bool                // log flush signal
+	sSignal        chan bool                // signal to stop task
+	uSignal        chan bool                // new definition of process is stored in update
+	update         atomic.Pointer[Task]     // new version of definition not used by Loop yet
+	eSignal        chan bool                // exit loop, trigered on task delete
+	logBuffer      []string                 // buffer for last 10 log lines
+	logBufferMutex sync.RWMutex             // mutex for log buffer operations
+	history        runHistory               // last runs of one-time task
+	exited         chan bool                // closed when Loop is finished
+	exitedOnce     sync.Once                // for lazy creation of exited channel
+	instances      atomic.Value             // instances of task ([]*Task / nil)
+	restartDone    chan bool                // end of restart requested by instances coordinator
+	sockets        *listenSockets           // sockets from Listen, shared by instances
+	notify         atomic.Pointer[notifier] // NOTIFY_SOCKET of task
+}
+
+// newTask returns task with own state, definition is decoded into it
+func newTask() *Task {
+	return &Task{taskRuntime: &taskRuntime{}}
 }
 
 // TaskStatus is simple struct suitable for marshaling
 type TaskStatus struct {
-	Status   string    `json:"status"`
-	Started  time.Time `json:"started,omitempty"`
-	Finished time.Time `json:"finished,omitempty"`
+	Status            TaskState       `json:"status"`
+	Running           bool            `json:"running"`
+	Error             string          `json:"error,omitempty"`
+	Started           time.Time       `json:"started,omitempty"`
+	Finished          time.Time       `json:"finished,omitempty"`
+	Uptime            float64         `json:"uptime,omitempty"` // in seconds
+	PID               int             `json:"pid,omitempty"`    // main process
+	PIDs              []int           `json:"pids,omitempty"`   // all processes (both during restart)
+	LastExit          *ExitInfo       `json:"lastExit,omitempty"`
+	Restarts          int             `json:"restarts"`
+	LastRestartReason string          `json:"lastRestartReason,omitempty"`
+	Env               []string        `json:"env,omitempty"`
+	Health            string          `json:"health,omitempty"`
+	NextRun           time.Time       `json:"nextRun,omitempty"`
+	LastRun           time.Time       `json:"lastRun,omitempty"`
+	CPUUsage          float64         `json:"cpuUsage,omitempty"`    // in seconds, tasks in cgroup only
+	MemoryUsage       uint64          `json:"memoryUsage,omitempty"` // in bytes, tasks in cgroup only
+	Priority          *PriorityStatus `json:"priority,omitempty"`    // of main process
+	Instances         []TaskStatus    `json:"instances,omitempty"`   // status of every instance
+	StatusText        string          `json:"statusText,omitempty"`  // last STATUS= notification
 }
 
 // GetStatus return task's status in struct
 func (t *Task) GetStatus() TaskStatus {
+	if instances := t.getInstances(); len(instances) > 0 {
+		return instancesStatus(instances)
+	}
+
 	result := TaskStatus{}
-	if status, ok := t.status.Load().(string); ok {
-		result.Status = status
-	} else {
-		result.Status = "not started"
+
+	t.info.Lock()
+	result.Status = t.info.state
+	if result.Status == "" {
+		result.Status = StateNotStarted
 	}
+	result.Error = t.info.err
+	result.PID = t.info.pids[t.info.main]
+	for _, pid := range t.info.pids {
+		if pid != 0 {
+			result.PIDs = append(result.PIDs, pid)
+		}
+	}
+	if nil != t.info.lastExit {
+		lastExit := *t.info.lastExit
+		result.LastExit = &lastExit
+	}
+	if t.info.starts > 1 {
+		result.Restarts = t.info.starts - 1
+	}
+	result.LastRestartReason = t.info.restartReason
+	t.info.Unlock()
+
+	result.Running = result.Status.Running()
+
 	if started, ok := t.timeStarted.Load().(time.Time); ok {
 		result.Started = started
+		if result.Running {
+			result.Uptime = time.Since(started).Seconds()
+		}
 	}
 
 	// Only include Finished time if the task is not running
-	if finished, ok := t.timeFinished.Load().(time.Time); ok {
-		// Check if the task is in a running state
-		if status, ok := t.status.Load().(string); ok {
-			isRunning := status == "running" || status == "started" || status == "restart validation" || status == "restart ok"
-			if !isRunning {
-				result.Finished = finished
-			}
-		} else {
-			result.Finished = finished
+	if finished, ok := t.timeFinished.Load().(time.Time); ok && !result.Running {
+		result.Finished = finished
+	}
+
+	if env, ok := t.envApplied.Load().([]string); ok {
+		result.Env = env
+	} else if len(t.Env) > 0 {
+		env := make([]string, 0, len(t.Env))
+		for key, value := range t.Env {
+			env = append(env, key+"="+value)
 		}
+		result.Env = maskEnv(env)
+	}
+
+	if health, ok := t.health.Load().(string); ok {
+		result.Health = health
+	}
+
+	if next, ok := t.nextRun.Load().(time.Time); ok {
+		result.NextRun = next
+	}
+	if last, ok := t.lastRun.Load().(time.Time); ok {
+		result.LastRun = last
 	}
 
+	if t.usesCgroup() {
+		result.CPUUsage, result.MemoryUsage = t.cgroupUsage()
+	}
+
+	if result.Running && result.PID != 0 {
+		result.Priority = readPriority(result.PID)
+	}
+
+	result.StatusText = t.getNotifyStatus()
+
 	return result
 }
 
-// Run task one time
-func (t *Task) Run(input []byte) {
+// prepareCmd creates command with all process attributes from task definition
+func (t *Task) prepareCmd(out io.Writer) (*exec.Cmd, error) {
+	cmd := exec.Command(t.Command, t.Args...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if t.WorkDir != "" {
+		cmd.Dir = t.WorkDir
+	}
+
+	env, err := t.buildEnv()
+	if nil != err {
+		return nil, err
+	}
+	cmd.Env = env
+
+	cred, err := t.credential()
+	if nil != err {
+		return nil, err
+	}
+	if nil != cred {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: cred}
+	}
+
+	if nil != t.sockets {
+		files, names, err := t.sockets.get(t)
+		if nil != err {
+			return nil, err
+		}
+		self, err := os.Executable()
+		if nil != err {
+			return nil, err
+		}
+
+		// process is started via helper, which sets LISTEN_PID to own pid
+		// and replaces itself with command
+		cmd.ExtraFiles = files
+		cmd.Env = append(cmd.Env,
+			listenExecEnv+"=1",
+			"LISTEN_FDS="+strconv.Itoa(len(files)),
+			"LISTEN_FDNAMES="+strings.Join(names, ":"))
+		cmd.Args = append([]string{self, cmd.Path}, cmd.Args...)
+		cmd.Path = self
+	}
+
+	if n := t.notify.Load(); nil != n {
+		cmd.Env = append(cmd.Env, "NOTIFY_SOCKET="+n.path)
+		if t.Watchdog > 0 {
+			cmd.Env = append(cmd.Env, "WATCHDOG_USEC="+
+				strconv.FormatInt(time.Duration(t.Watchdog).Microseconds(), 10))
+		}
+	}
+
+	if t.KillMode == killModeGroup {
+		if nil == cmd.SysProcAttr {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.SysProcAttr.Setpgid = true
+	}
+
+	return cmd, nil
+}
+
+// tryStartRun marks one-time task as running,
+// returns false if it's just running
+func (t *Task) tryStartRun() bool {
+	t.oneTimeMutex.Lock()
+	defer t.oneTimeMutex.Unlock()
+
+	if t.oneTimeRunning {
+		return false
+	}
+	t.oneTimeRunning = true
+	return true
+}
+
+// Run task one time, trigger ("http", "schedule") is stored in run history,
+// stdout and stderr are captured into result if requested
+func (t *Task) Run(input []byte, trigger string, capture bool) *RunResult {
 
 	defer func() {
 		t.oneTimeMutex.Lock()
@@ -85,72 +304,141 @@ func (t *Task) Run(input []byte) {
 	t.cSignal = make(chan os.Signal)
 	t.sSignal = make(chan bool)
 
+	// cgroup of run is removed by killRest, cgroup of task after run
+	if t.usesCgroup() {
+		defer t.removeCgroup()
+	}
+
 	config := aConfig.Load()
 
 	// for log rotation we need layer in the middle
-	writer := logWithRotation(fmt.Sprintf("%s/%s%s.log",
+	logWriter := logWithRotation(fmt.Sprintf("%s/%s%s.log",
 		config.LogDir, config.LogPrefix, t.name),
 		config.LogSuffixDate, t.fSignal, config.LogDate,
 		t.name, config.GrayLog, t)
 	defer func() {
-		err := writer.Close()
+		err := logWriter.Close()
 		if nil != err {
 			log.Println("Error closing output: ", err)
 		}
 	}()
 
-	fmt.Fprintf(writer, "[minisv] Starting %s %v\n", t.Command, t.Args)
-	cmd := exec.Command(t.Command, t.Args...)
-	cmd.Stdout = writer
-	cmd.Stderr = writer
-	if nil != input {
-		cmd.Stdin = bytes.NewReader(input)
-	}
-	if t.WorkDir != "" {
-		cmd.Dir = t.WorkDir
+	started := time.Now()
+	record := &runRecord{
+		ID:        newRunID(started),
+		Trigger:   trigger,
+		InputSize: len(input),
+		Started:   started,
+		Status:    StateStarting,
 	}
+	runOutput := t.openRunOutput(record)
+	defer func() {
+		err := runOutput.Close()
+		if nil != err {
+			log.Println("Error closing run output: ", err)
+		}
+	}()
+	t.addRun(record)
+
+	// output goes both to task log and to file of this run
+	writer := io.MultiWriter(logWriter, runOutput)
 
-	t.timeStarted.Store(time.Now())
-	t.status.Store("starting")
+	fmt.Fprintf(writer, "[minisv] Starting %s %v (run %s)\n",
+		t.Command, t.Args, record.ID)
 
-	err := cmd.Start()
+	t.timeStarted.Store(started)
+	t.setState(StateStarting, nil)
+
+	result := &RunResult{RunID: record.ID, Started: started}
+	var stdout, stderr captureBuffer
+
+	var cmd *exec.Cmd
+	err := t.runHook(hookPreStart, 0, writer)
+	if nil == err {
+		cmd, err = t.prepareCmd(writer)
+	}
+	if nil == err {
+		if capture {
+			cmd.Stdout = io.MultiWriter(writer, &stdout)
+			cmd.Stderr = io.MultiWriter(writer, &stderr)
+		}
+		if nil != input {
+			cmd.Stdin = bytes.NewReader(input)
+		}
+		err = t.startCmd(cmd, 0)
+	}
 	if nil != err {
 		fmt.Fprintf(writer, "[minisv] Error starting %s (%s): %v\n",
 			t.name, t.Command, err)
-		t.status.Store("start failed: " + err.Error())
+		t.setState(StateStartFailed, err)
 		t.timeFinished.Store(time.Now())
-		return
+		result.Status = StateStartFailed
+		result.ExitCode = -1
+		result.Error = err.Error()
+		result.Finished = time.Now()
+		t.finishRun(record, result)
+		return result
 	}
 
-	t.status.Store("running")
+	t.applyLimits(cmd.Process.Pid, writer)
+	t.applyPriority(cmd.Process.Pid, writer)
+	t.setState(StateRunning, nil)
+	t.setPID(0, cmd.Process.Pid)
+	t.countStart(trigger)
+
+	_ = t.runHook(hookPostStart, cmd.Process.Pid, writer)
 
 	cmdDone := make(chan error)
 	go func() {
-		cmdDone <- cmd.Wait()
+		cmdDone <- waitProcess(cmd)
 	}()
 
-	killIt := make(chan bool)
+	killIt := make(chan bool, 1)
 	killCanceled := false
 
+	var timeout <-chan time.Time
+	timedOut := false
+	if t.Timeout > 0 {
+		timeout = time.After(time.Duration(t.Timeout))
+	}
+
 itsDone:
 	for {
 		select {
 
 		case err = <-cmdDone:
 			killCanceled = true
+			t.killRest(cmd, 0, writer)
+			// hook's error can't replace exit status of command
+			_ = t.runHook(hookPostStop, cmd.Process.Pid, writer)
 			break itsDone
 
 		case sig := <-t.cSignal:
 			fmt.Fprintln(writer, "[minisv] Sending ", sig,
 				" signal to process ", cmd.Process.Pid)
-			err = cmd.Process.Signal(sig)
+			err = t.signalChild(cmd, 0, sig)
 			if nil != err {
 				fmt.Fprintln(writer, "[minisv] Error sending ", sig, ": ", err)
 			}
 
 		case <-t.sSignal:
 			fmt.Fprintln(writer, "[minisv] Stopping task")
-			err = cmd.Process.Signal(syscall.SIGTERM)
+			_ = t.runHook(hookPreStop, cmd.Process.Pid, writer)
+			err = t.signalChild(cmd, 0, syscall.SIGTERM)
+			if nil != err {
+				fmt.Fprintln(writer, "[minisv] Error sending SIGTERM: ", err)
+			}
+			go func() {
+				time.Sleep(time.Duration(t.Wait) * time.Second)
+				killIt <- true
+			}()
+
+		case <-timeout:
+			timedOut = true
+			fmt.Fprintln(writer, "[minisv] Timeout", time.Duration(t.Timeout),
+				"reached, stopping task")
+			_ = t.runHook(hookPreStop, cmd.Process.Pid, writer)
+			err = t.signalChild(cmd, 0, syscall.SIGTERM)
 			if nil != err {
 				fmt.Fprintln(writer, "[minisv] Error sending SIGTERM: ", err)
 			}
@@ -162,7 +450,7 @@ itsDone:
 		case <-killIt:
 			if !killCanceled {
 				fmt.Fprintln(writer, "[minisv] Killing task")
-				err = cmd.Process.Signal(syscall.SIGKILL)
+				err = t.signalChild(cmd, 0, syscall.SIGKILL)
 				if nil != err {
 					fmt.Fprintln(writer, "[minisv] Error sending SIGKILL: ", err)
 				}
@@ -171,26 +459,74 @@ itsDone:
 		}
 	}
 
-	if nil != err {
-		t.status.Store("finished with error: " + err.Error())
+	t.setPID(0, 0)
+	t.setExit(err)
+
+	if timedOut {
+		t.setState(StateTimedOut, err)
+		fmt.Fprintf(writer, "[minisv] Command %s (%s) timed out after %v, exit: %v\n",
+			t.name, t.Command, time.Duration(t.Timeout), err)
+	} else if nil != err {
+		t.setState(StateFailed, err)
 		fmt.Fprintf(writer, "[minisv] Command %s (%s) ended with error: %v\n",
 			t.name, t.Command, err)
 	} else {
-		t.status.Store("finished")
+		t.setState(StateFinished, nil)
 	}
 	t.timeFinished.Store(time.Now())
-}
 
-// Loop task runinng and restarting
-func (t *Task) Loop(cExit chan bool, wg *sync.WaitGroup) {
-	defer wg.Done()
+	exit := newExitInfo(err)
+	result.Status = t.getState()
+	result.ExitCode = exit.Code
+	result.Signal = exit.Signal
+	result.CoreDumped = exit.CoreDumped
+	result.TimedOut = timedOut
+	if nil != err {
+		result.Error = err.Error()
+	}
+	result.Finished = time.Now()
+	result.Duration = result.Finished.Sub(result.Started).Seconds()
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+	result.Truncated = stdout.truncated || stderr.truncated
+	t.finishRun(record, result)
+
+	return result
+}
 
-	// init channels
+// initChannels creates channels used to control Loop
+func (t *Task) initChannels() {
 	t.cSignal = make(chan os.Signal)
 	t.rSignal = make(chan bool)
 	t.fSignal = make(chan bool)
 	t.sSignal = make(chan bool)
+	t.uSignal = make(chan bool)
 	t.eSignal = make(chan bool)
+}
+
+// Loop task runinng and restarting
+func (t *Task) Loop(cExit chan bool, wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer close(t.exitedChan())
+
+	// instances get channels from coordinator before start
+	if nil == t.rSignal {
+		t.initChannels()
+	}
+
+	if t.Instances > 1 {
+		t.instancesLoop(cExit)
+		return
+	}
+
+	if t.usesCgroup() {
+		defer t.removeCgroup()
+	}
+
+	if len(t.Listen) > 0 && nil == t.sockets {
+		t.sockets = &listenSockets{}
+		defer t.sockets.close()
+	}
 
 	config := aConfig.Load()
 
@@ -206,35 +542,88 @@ func (t *Task) Loop(cExit chan bool, wg *sync.WaitGroup) {
 		}
 	}()
 
+	if !t.waitDependencies(out, cExit) {
+		return
+	}
+
+	if nil != t.HealthCheck {
+		stopHealth := make(chan bool)
+		defer close(stopHealth)
+		go t.healthLoop(t.HealthCheck, out, stopHealth)
+	}
+
+	if t.Notify || t.Watchdog > 0 {
+		n, err := t.newNotifier(out)
+		if nil != err {
+			fmt.Fprintln(out, "[minisv] Error creating notify socket:", err)
+		} else {
+			t.notify.Store(n)
+			defer n.close()
+
+			if t.Watchdog > 0 {
+				stopWatchdog := make(chan bool)
+				defer close(stopWatchdog)
+				go t.watchdogLoop(n, out, stopWatchdog)
+			}
+		}
+	}
+
 	var err error
 
 	// true - main is cmd1, false - main is cmd2 :)
 	stage := true
 
-	startNext := func(okstatus string) (*exec.Cmd, chan error, error) {
+	// slot of process: 0 - cmd1, 1 - cmd2
+	slotOf := func(cmd1slot bool) int {
+		if cmd1slot {
+			return 0
+		}
+		return 1
+	}
+
+	startNext := func(slot int, okstate TaskState) (*exec.Cmd, chan error, error) {
 		fmt.Fprintf(out, "[minisv] Starting %s %v\n", t.Command, t.Args)
-		cmd := exec.Command(t.Command, t.Args...)
-		cmd.Stdout = out
-		cmd.Stderr = out
-		if t.WorkDir != "" {
-			cmd.Dir = t.WorkDir
+
+		if okstate != StateRestartValidation {
+			t.setState(StateStarting, nil)
 		}
+		started := time.Now()
+		t.timeStarted.Store(started)
 
-		t.status.Store("starting")
-		t.timeStarted.Store(time.Now())
-		err = cmd.Start()
+		var cmd *exec.Cmd
+		err = t.runHook(hookPreStart, 0, out)
+		if nil == err {
+			cmd, err = t.prepareCmd(out)
+		}
+		if nil == err {
+			err = t.startCmd(cmd, slot)
+		}
 		if nil != err {
-			t.status.Store("Error starting: " + err.Error())
+			t.setState(StateStartFailed, err)
 			fmt.Fprintf(out, "[minisv] Error starting %s (%s): %v\n",
 				t.name, t.Command, err)
-			time.Sleep(time.Second * time.Duration(t.Pause))
 			return nil, nil, err
 		}
-		t.status.Store(okstatus)
+		t.applyLimits(cmd.Process.Pid, out)
+		t.applyPriority(cmd.Process.Pid, out)
+		if t.Notify && okstate == StateStarted {
+			// process counts as started only after READY=1
+			okstate = StateStarting
+		}
+		t.setState(okstate, nil)
+		t.setPID(slot, cmd.Process.Pid)
+
+		if n := t.notify.Load(); okstate == StateStarting && nil != n {
+			if ready, _ := n.readySince(started, -1); ready {
+				t.compareAndSetState(StateStarting, StateStarted)
+			}
+		}
+
+		_ = t.runHook(hookPostStart, cmd.Process.Pid, out)
 
 		cmdDone := make(chan error)
 		go func() {
-			cmdDone <- cmd.Wait()
+			cmdDone <- waitProcess(cmd)
 		}()
 
 		return cmd, cmdDone, nil
@@ -244,185 +633,303 @@ func (t *Task) Loop(cExit chan bool, wg *sync.WaitGroup) {
 	var done1, done2 chan error
 	var run1, run2 bool
 
-	for {
-		if !t.stopped {
-			if stage && !run1 {
-				cmd1, done1, err = startNext("started")
-				run1 = nil == err
-			}
-			if !stage && !run2 {
-				cmd2, done2, err = startNext("started")
-				run2 = nil == err
+	restarts := restartState{}
+	var restartTimer <-chan time.Time // pause before next start
+	startReason := "start"            // reason of next start of main process
+
+	// exited handles exit of process in slot
+	exited := func(slot int, main bool, err error) {
+		t.setPID(slot, 0)
+		cmd := cmd1
+		if slot == 1 {
+			cmd = cmd2
+		}
+		t.killRest(cmd, slot, out)
+		_ = t.runHook(hookPostStop, cmd.Process.Pid, out)
+
+		if !main {
+			if nil == err {
+				fmt.Fprintln(out, "[minisv] Old process normal exit")
+			} else {
+				fmt.Fprintln(out, "[minisv] Old process exited, ", err)
 			}
+			return
 		}
 
-		select {
-		case err = <-done1:
+		t.timeFinished.Store(time.Now())
+		t.setExit(err)
 
-			run1 = false
+		if nil == err {
+			fmt.Fprintln(out, "[minisv] Main process normal exit")
+			t.setState(StateFinished, nil)
+			startReason = "exit: normal"
+		} else {
+			fmt.Fprintln(out, "[minisv] Main process exited, ", err)
+			t.setState(StateFailed, err)
+			startReason = "exit: " + err.Error()
+		}
+	}
 
-			if stage {
+	// gracefulRestart starts new process and stops old one after validation
+	gracefulRestart := func(reason string) {
+		fmt.Fprintln(out, "[minisv] Doing graceful restart")
+		newSlot := slotOf(!stage)
 
-				t.timeFinished.Store(time.Now())
+		// castling of running processes
+		if stage {
+			cmd2, done2, err = startNext(newSlot, StateRestartValidation)
+			run2 = nil == err
 
-				if nil == err {
-					fmt.Fprintln(out, string("[minisv] Main process normal exit"))
-					t.status.Store("finished")
-				} else {
-					fmt.Fprintln(out, "[minisv] Main process exited, ", err)
-					t.status.Store("finished with error: " + err.Error())
-				}
+		} else {
+			cmd1, done1, err = startNext(newSlot, StateRestartValidation)
+			run1 = nil == err
+		}
 
-			} else {
+		if nil != err {
+			t.setState(StateStarted,
+				fmt.Errorf("restart failed, unable to start new instance: %w", err))
+			fmt.Fprintln(out,
+				"[minisv] Unable to start new instance, continue using old one")
+			return
+		}
 
-				if nil == err {
-					fmt.Fprintln(out, "[minisv] Old process normal exit")
+		newCmd, newDone, oldCmd := cmd2, done2, cmd1
+		if !stage {
+			newCmd, newDone, oldCmd = cmd1, done1, cmd2
+		}
+		newStarted, _ := t.timeStarted.Load().(time.Time)
+
+		newExited := waitForErrChan(newDone, time.Second*time.Duration(t.StartTime))
+
+		if !newExited {
+			err = t.waitNewInstance(newCmd.Process.Pid, oldCmd.Process.Pid,
+				newStarted, newDone, out)
+			if errors.Is(err, errNewInstanceExited) {
+				newExited = true
+			} else if nil != err {
+				fmt.Fprintln(out, "[minisv] New instance is not ready, rolling back:", err)
+				t.termChild(true, newCmd, newSlot, newDone, out, nil)
+				if stage {
+					run2 = false
 				} else {
-					fmt.Fprintln(out, "[minisv] Old process exited, ", err)
+					run1 = false
 				}
-				// don't need wait after old process exit
-				continue
+				t.setPID(newSlot, 0)
+				t.setState(StateStarted,
+					fmt.Errorf("restart failed, new instance is not ready: %w", err))
+				return
 			}
+		}
 
-		case err = <-done2:
-
-			run2 = false
-
+		if newExited {
+			t.killRest(newCmd, newSlot, out)
+			_ = t.runHook(hookPostStop, newCmd.Process.Pid, out)
 			if stage {
-
-				if nil == err {
-					fmt.Fprintln(out, "[minisv] Old process normal exit")
-				} else {
-					fmt.Fprintln(out, "[minisv] Old process exited, ", err)
-				}
-				// don't need wait after old process exit
-				continue
-
+				run2 = false
 			} else {
+				run1 = false
+			}
+			t.setPID(newSlot, 0)
+			t.setState(StateStarted,
+				errors.New("restart failed, new instance exited too fast"))
+			fmt.Fprintln(out,
+				"[minisv] New instance exited too fast, continue using old one")
+			return
+		}
 
-				t.timeFinished.Store(time.Now())
+		stage = !stage
+		t.setMainSlot(newSlot)
+		t.countStart(reason)
 
-				if nil == err {
-					fmt.Fprintln(out, "[minisv] Main process normal exit")
-					t.status.Store("finished")
-				} else {
-					fmt.Fprintln(out, "[minisv] Main process exited, ", err)
-					t.status.Store("finished with error: " + err.Error())
-				}
+		t.setState(StateRestartOK, nil)
+		fmt.Fprintln(out, "[minisv] New instance running, terminating old one")
+		if stage {
+			t.termChild(run2, cmd2, 1, done2, out, nil)
+			run2 = false
+		} else {
+			t.termChild(run1, cmd1, 0, done1, out, nil)
+			run1 = false
+		}
+		t.setPID(slotOf(!stage), 0)
+	}
 
-			}
+	restarted := false // restart was requested using rSignal or uSignal
 
-		case sig := <-t.cSignal:
+	for {
+		startFailed := false
+		if !t.stopped && nil == restartTimer && ((stage && !run1) || (!stage && !run2)) {
 			if stage {
-				fmt.Fprintln(out, "[minisv] Sending ", sig,
-					" signal to process ", cmd1.Process.Pid)
-				err = cmd1.Process.Signal(sig)
-				if nil != err {
-					fmt.Fprintln(out, "[minisv] Error sending ", sig, ": ", err)
-				}
+				cmd1, done1, err = startNext(0, StateStarted)
+				run1 = nil == err
 			} else {
-				fmt.Fprintln(out, "[minisv] Sending ", sig,
-					" signal to process ", cmd2.Process.Pid)
-				err = cmd2.Process.Signal(sig)
-				if nil != err {
-					fmt.Fprintln(out, "[minisv] Error sending ", sig, ": ", err)
-				}
+				cmd2, done2, err = startNext(1, StateStarted)
+				run2 = nil == err
 			}
 
-			continue
-
-		case <-t.sSignal:
-			fmt.Fprintln(out, "[minisv] Stopping task")
-			t.stopped = true
-
-			if stage {
-				termChild(run1, cmd1, done1, t.Wait, out, nil)
-				run1 = false
+			if nil == err {
+				t.countStart(startReason)
 			} else {
-				termChild(run2, cmd2, done2, t.Wait, out, nil)
-				run2 = false
+				startFailed = true
+				startReason = "start failed: " + err.Error()
 			}
+		}
 
-			t.timeFinished.Store(time.Now())
-			t.status.Store("stoped")
+		if restarted {
+			restarted = false
+			t.notifyRestartDone()
+		}
 
-			continue
+		// unable to start is handled the same way as exit of main process
+		if !startFailed {
+			select {
+			case err = <-done1:
 
-		case <-t.rSignal:
-			if t.stopped {
-				t.stopped = false
-				fmt.Fprintln(out, "[minisv] Starting task")
-			} else {
+				run1 = false
+				exited(0, stage, err)
 
-				fmt.Fprintln(out, "[minisv] Doing graceful restart")
+				if !stage {
+					// don't need wait after old process exit
+					continue
+				}
 
-				// castling of running processes
-				if stage {
-					cmd2, done2, err = startNext("restart validation")
-					run2 = nil == err
+			case err = <-done2:
 
-				} else {
-					cmd1, done1, err = startNext("restart validation")
-					run1 = nil == err
-				}
+				run2 = false
+				exited(1, !stage, err)
 
-				if nil != err {
-					t.status.Store("new instance failed")
-					fmt.Fprintln(out,
-						"[minisv] Unable to start new instance, continue using old one")
+				if stage {
+					// don't need wait after old process exit
 					continue
 				}
 
-				var exited bool
+			case sig := <-t.cSignal:
 				if stage {
-					exited = waitForErrChan(done2, time.Second*time.Duration(t.StartTime))
+					fmt.Fprintln(out, "[minisv] Sending ", sig,
+						" signal to process ", cmd1.Process.Pid)
+					err = t.signalChild(cmd1, 0, sig)
+					if nil != err {
+						fmt.Fprintln(out, "[minisv] Error sending ", sig, ": ", err)
+					}
 				} else {
-					exited = waitForErrChan(done1, time.Second*time.Duration(t.StartTime))
+					fmt.Fprintln(out, "[minisv] Sending ", sig,
+						" signal to process ", cmd2.Process.Pid)
+					err = t.signalChild(cmd2, 1, sig)
+					if nil != err {
+						fmt.Fprintln(out, "[minisv] Error sending ", sig, ": ", err)
+					}
 				}
 
-				if exited {
-					t.status.Store("new instance exited too fast")
-					fmt.Fprintln(out,
-						"[minisv] New instance exited too fast, continue using old one")
-					continue
-				}
+				continue
 
-				stage = !stage
+			case <-t.sSignal:
+				fmt.Fprintln(out, "[minisv] Stopping task")
+				t.stopped = true
+				restartTimer = nil
 
-				t.status.Store("restart ok")
-				fmt.Fprintln(out, "[minisv] New instance running, terminating old one")
 				if stage {
-					termChild(run2, cmd2, done2, t.Wait, out, nil)
+					t.termChild(run1, cmd1, 0, done1, out, nil)
+					run1 = false
 				} else {
-					termChild(run1, cmd1, done1, t.Wait, out, nil)
+					t.termChild(run2, cmd2, 1, done2, out, nil)
+					run2 = false
 				}
+				t.setPID(slotOf(stage), 0)
+
+				t.timeFinished.Store(time.Now())
+				t.setState(StateStopped, nil)
+
+				continue
+
+			case <-restartTimer:
+				restartTimer = nil
+				continue
+
+			case <-t.rSignal:
+				restarted = true
+				if t.stopped || nil != restartTimer {
+					t.stopped = false
+					restartTimer = nil
+					restarts.reset()
+					startReason = t.takeRestartReason("start requested")
+					fmt.Fprintln(out, "[minisv] Starting task")
+				} else {
+					gracefulRestart(t.takeRestartReason("restart requested"))
+				}
+
+				continue
+
+			case <-t.uSignal:
+				restarted = true
+				def := t.update.Swap(nil)
+				if nil == def {
+					continue
+				}
+				// new version shares state with this one, so loop just
+				// continues with it (closures above use t too)
+				restart := processChanged(t, def)
+				t = def
+				if !restart {
+					fmt.Fprintln(out, "[minisv] Task settings changed")
+					continue
+				}
+				fmt.Fprintln(out, "[minisv] Task definition changed")
+				// stopped task or task waiting for restart just gets new definition
+				if !t.stopped && nil == restartTimer {
+					gracefulRestart("config reload")
+				}
+
+				continue
+
+			case <-cExit:
+				t.waitDependents(out)
+				fmt.Fprintln(out, "[minisv] Sending term signal to childs")
+				smallWg := sync.WaitGroup{}
+				smallWg.Add(2)
+				go t.termChild(run1, cmd1, 0, done1, out, &smallWg)
+				go t.termChild(run2, cmd2, 1, done2, out, &smallWg)
+				smallWg.Wait()
+				return
+
+			case <-t.eSignal:
+				fmt.Fprintln(out, "[minisv] {taskExit} Sending term signal to childs")
+				smallWg := sync.WaitGroup{}
+				smallWg.Add(2)
+				go t.termChild(run1, cmd1, 0, done1, out, &smallWg)
+				go t.termChild(run2, cmd2, 1, done2, out, &smallWg)
+				smallWg.Wait()
+				return
 			}
+		}
 
-			continue
+		now := time.Now()
+		uptime := time.Duration(0)
+		if started, ok := t.timeStarted.Load().(time.Time); ok {
+			uptime = now.Sub(started)
+		}
 
-		case <-cExit:
-			fmt.Fprintln(out, "[minisv] Sending term signal to childs")
-			smallWg := sync.WaitGroup{}
-			smallWg.Add(2)
-			go termChild(run1, cmd1, done1, t.Wait, out, &smallWg)
-			go termChild(run2, cmd2, done2, t.Wait, out, &smallWg)
-			smallWg.Wait()
-			return
+		if !t.shouldRestart(err) {
+			fmt.Fprintf(out, "[minisv] Not restarting, restart policy is \"%s\"\n",
+				t.RestartPolicy)
+			t.stopped = true
+			continue
+		}
 
-		case <-t.eSignal:
-			fmt.Fprintln(out, "[minisv] {taskExit} Sending term signal to childs")
-			smallWg := sync.WaitGroup{}
-			smallWg.Add(2)
-			go termChild(run1, cmd1, done1, t.Wait, out, &smallWg)
-			go termChild(run2, cmd2, done2, t.Wait, out, &smallWg)
-			smallWg.Wait()
-			return
+		if t.isCrashLoop(&restarts, now) {
+			fmt.Fprintf(out, "[minisv] Task exited more than %d times in %v, giving up\n",
+				t.CrashLoop.MaxExits, t.CrashLoop.window())
+			t.stopped = true
+			t.setState(StateCrashLoop, err)
+			continue
 		}
 
-		if t.Pause != 0 {
-			fmt.Fprintln(out, "Waiting ",
-				time.Second*time.Duration(t.Pause), " before restart")
-			time.Sleep(time.Second * time.Duration(t.Pause))
+		pause := t.restartPause(&restarts, uptime)
+		if startFailed && pause < time.Second {
+			// failed start is immediate, signals are handled only while waiting
+			pause = time.Second
+		}
+		if pause > 0 {
+			fmt.Fprintln(out, "Waiting ", pause, " before restart")
+			restartTimer = time.After(pause)
 		}
 	}
 }
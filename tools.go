@@ -19,8 +19,8 @@ func waitForErrChan(c chan error, t time.Duration) bool {
 	}
 }
 
-func termChild(running bool, cmd *exec.Cmd, ch chan error,
-	wait int, out io.Writer, wg *sync.WaitGroup) {
+func (t *Task) termChild(running bool, cmd *exec.Cmd, slot int, ch chan error,
+	out io.Writer, wg *sync.WaitGroup) {
 	if nil != wg {
 		defer wg.Done()
 	}
@@ -28,7 +28,12 @@ func termChild(running bool, cmd *exec.Cmd, ch chan error,
 		return
 	}
 
-	err := cmd.Process.Signal(syscall.SIGTERM)
+	wait := time.Duration(t.Wait) * time.Second
+	pid := cmd.Process.Pid
+
+	_ = t.runHook(hookPreStop, pid, out)
+
+	err := t.signalChild(cmd, slot, syscall.SIGTERM)
 	if nil != err {
 		_, e := fmt.Fprintln(out, "Error sending TERM signal: ", err)
 		if nil != e {
@@ -36,19 +41,23 @@ func termChild(running bool, cmd *exec.Cmd, ch chan error,
 		}
 	}
 
-	if !waitForErrChan(ch, time.Duration(wait)*time.Second) {
+	if !waitForErrChan(ch, wait) {
 		_, e := fmt.Fprintln(out, "Process is still running, sending kill signal")
 		if nil != e {
 			log.Println("Error writing log: ", err)
 		}
 
-		err = cmd.Process.Kill()
+		err = t.signalChild(cmd, slot, syscall.SIGKILL)
 		if nil != err {
 			_, e := fmt.Fprintln(out, "Error sending KILL signal: ", err)
 			if nil != e {
 				log.Println("Error writing log: ", err)
 			}
 		}
+
+		waitForErrChan(ch, wait)
 	}
 
+	t.killRest(cmd, slot, out)
+	_ = t.runHook(hookPostStop, pid, out)
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"syscall"
 )
@@ -46,6 +47,31 @@ func setLimit(limit configRLimit) error {
 	return nil
 }
 
+// checkRLimits validates types of limits
+func checkRLimits(limits []configRLimit) error {
+	for _, limit := range limits {
+		if _, ok := rlimitTypes[limit.Type]; !ok {
+			return fmt.Errorf("\"%s\": %w", limit.Type, errInvalidRLimit)
+		}
+	}
+	return nil
+}
+
+// checkLimits validates types of task limits
+func (t *Task) checkLimits() error {
+	return checkRLimits(t.Limits)
+}
+
+// applyLimits sets task limits to just started child process
+func (t *Task) applyLimits(pid int, out io.Writer) {
+	for _, limit := range t.Limits {
+		err := setChildLimit(pid, limit)
+		if nil != err {
+			fmt.Fprintln(out, "[minisv] Error setting limit for \""+limit.Type+"\":", err)
+		}
+	}
+}
+
 func processRLimits(limits []configRLimit) {
 	for _, limit := range limits {
 		err := setLimit(limit)
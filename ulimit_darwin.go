@@ -1,6 +1,9 @@
 package main
 
-import "syscall"
+import (
+	"errors"
+	"syscall"
+)
 
 var (
 	rlimitTypes = map[string]int{
@@ -14,3 +17,11 @@ var (
 		"stack":  syscall.RLIMIT_STACK,
 	}
 )
+
+var (
+	errChildLimitUnsupported = errors.New("limits of task are supported only on linux")
+)
+
+func setChildLimit(pid int, limit configRLimit) error {
+	return errChildLimitUnsupported
+}
@@ -1,6 +1,10 @@
 package main
 
-import "syscall"
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
 
 var (
 	rlimitTypes = map[string]int{
@@ -14,3 +18,43 @@ var (
 		"stack":  syscall.RLIMIT_STACK,
 	}
 )
+
+func prlimit(pid int, id int, newLimit *syscall.Rlimit, oldLimit *syscall.Rlimit) error {
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid),
+		uintptr(id), uintptr(unsafe.Pointer(newLimit)),
+		uintptr(unsafe.Pointer(oldLimit)), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// setChildLimit sets limit of other process (child) using prlimit
+func setChildLimit(pid int, limit configRLimit) error {
+	id, ok := rlimitTypes[limit.Type]
+	if !ok {
+		return errInvalidRLimit
+	}
+
+	rLimit := syscall.Rlimit{
+		Cur: limit.Cur,
+		Max: limit.Max,
+	}
+
+	err := prlimit(pid, id, &rLimit, nil)
+	if nil != err {
+		return err
+	}
+
+	err = prlimit(pid, id, nil, &rLimit)
+	if nil != err {
+		return err
+	}
+
+	if rLimit.Cur != limit.Cur || rLimit.Max != limit.Max {
+		return fmt.Errorf("try to set %d/%d, but got %d/%d",
+			limit.Cur, limit.Max, rLimit.Cur, rLimit.Max)
+	}
+
+	return nil
+}
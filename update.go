@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+// taskUpdateResult is response to update of task definition
+type taskUpdateResult struct {
+	Action string     `json:"action"` // "unchanged", "updated", "restarted" or "replaced"
+	Status TaskStatus `json:"status"`
+}
+
+// mergePatch applies JSON merge patch (RFC 7396) to decoded JSON document
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for key, value := range p {
+		if nil == value {
+			delete(t, key)
+			continue
+		}
+		t[key] = mergePatch(t[key], value)
+	}
+	return t
+}
+
+// mergeTaskPatch returns JSON of task definition with patch applied
+func mergeTaskPatch(task *Task, patch []byte) ([]byte, error) {
+	data, err := json.Marshal(task)
+	if nil != err {
+		return nil, err
+	}
+
+	var doc, p interface{}
+	err = json.Unmarshal(data, &doc)
+	if nil != err {
+		return nil, err
+	}
+	err = json.Unmarshal(patch, &p)
+	if nil != err {
+		return nil, err
+	}
+
+	return json.Marshal(mergePatch(doc, p))
+}
+
+// updateTask replaces definition of task in config (configChangeLock should
+// be held): running task gets changed restart settings or process definition
+// (via graceful restart), with other changes task is stopped and started
+// again, returns action (see compareTasks)
+func updateTask(config *Config, old *Task, task *Task, trigger string) (string, error) {
+	action, err := compareTasks(old, task)
+	if nil != err {
+		return "", err
+	}
+	if action == taskUnchanged {
+		return action, nil
+	}
+
+	newTasks := make(map[string]*Task, len(config.Tasks))
+	for name, t := range config.Tasks {
+		newTasks[name] = t
+	}
+	newTasks[task.name] = task
+
+	err = checkDependencies(newTasks)
+	if nil != err {
+		return "", err
+	}
+
+	if action == taskReplaced {
+		stopTask(old)
+	} else {
+		task.takeOver(old)
+	}
+
+	config.Tasks = newTasks
+	aConfig.Store(config)
+
+	if action == taskReplaced {
+		startTask(task)
+	}
+	go saveConfig(trigger)
+
+	return action, nil
+}
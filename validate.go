@@ -0,0 +1,221 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// configProblem describes one problem found by config validation
+type configProblem struct {
+	Task    string `json:"task,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p configProblem) String() string {
+	prefix := ""
+	if p.Task != "" {
+		prefix = "task " + p.Task + ": "
+	}
+	if p.Field != "" {
+		prefix += p.Field + ": "
+	}
+	return prefix + p.Message
+}
+
+// configProblems is list of all problems found in config
+type configProblems []configProblem
+
+func (p configProblems) Error() string {
+	messages := make([]string, 0, len(p))
+	for _, problem := range p {
+		messages = append(messages, problem.String())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// checkCommand returns error if command of task can't be executed,
+// relative path is resolved from workdir as on start
+func (t *Task) checkCommand() error {
+	command := t.Command
+	if strings.Contains(command, "/") && !filepath.IsAbs(command) && t.WorkDir != "" {
+		command = filepath.Join(t.WorkDir, command)
+	}
+	_, err := exec.LookPath(command)
+	return err
+}
+
+// checkWorkDir returns error if workdir of task is not existing directory
+func (t *Task) checkWorkDir() error {
+	info, err := os.Stat(t.WorkDir)
+	if nil != err {
+		return err
+	}
+	if !info.IsDir() {
+		return errors.New("not a directory")
+	}
+	return nil
+}
+
+// validate returns all problems of task definition, strict validation also
+// checks that command and workdir exist (not done on start and reload as
+// they can appear later)
+func (t *Task) validate(strict bool) configProblems {
+	var problems configProblems
+	add := func(field string, err error) {
+		problems = append(problems, configProblem{
+			Task:    t.name,
+			Field:   field,
+			Message: err.Error(),
+		})
+	}
+
+	if t.Command == "" {
+		add("command", errors.New("command is required"))
+	} else if strict {
+		if err := t.checkCommand(); nil != err {
+			add("command", err)
+		}
+	}
+	if strict && t.WorkDir != "" {
+		if err := t.checkWorkDir(); nil != err {
+			add("workdir", err)
+		}
+	}
+
+	checks := []struct {
+		field string
+		check func() error
+	}{
+		{"restartPolicy", t.checkRestartPolicy},
+		{"backoff", t.checkBackoff},
+		{"healthCheck", t.checkHealthCheck},
+		{"readinessProbe", t.checkReadiness},
+		{"schedule", t.checkSchedule},
+		{"killMode", t.checkKillMode},
+		{"cgroup", t.checkCgroup},
+		{"limits", t.checkLimits},
+		{"priority", t.checkPriority},
+		{"instances", t.checkInstances},
+		{"listen", t.checkListen},
+		{"watchdog", t.checkNotify},
+		{"hooks", t.checkHooks},
+	}
+	for _, c := range checks {
+		if err := c.check(); nil != err {
+			add(c.field, err)
+		}
+	}
+
+	return problems
+}
+
+// checkTLS returns error if certificates of http server can't be loaded
+func checkTLS(config *Config) error {
+	if config.HTTP.ServerCert == "" || config.HTTP.ServerKey == "" {
+		return nil
+	}
+	_, err := tls.LoadX509KeyPair(config.HTTP.ServerCert, config.HTTP.ServerKey)
+	if nil != err {
+		return err
+	}
+	if config.HTTP.ClientCert != "" {
+		_, err = os.ReadFile(config.HTTP.ClientCert)
+	}
+	return err
+}
+
+// validateConfig decodes config and returns it with all found problems,
+// every task is decoded separately to report problems of all of them;
+// strict validation is used by -check (see also Task.validate)
+func validateConfig(data []byte, strict bool) (*Config, configProblems) {
+	data, err := configToJSON(data)
+	if nil != err {
+		return nil, configProblems{{Message: "error parsing config: " + err.Error()}}
+	}
+
+	var raw struct {
+		Tasks map[string]json.RawMessage `json:"tasks"`
+	}
+	err = json.Unmarshal(data, &raw)
+	if nil != err {
+		return nil, configProblems{{Message: "error parsing config: " + err.Error()}}
+	}
+
+	var problems configProblems
+	var config Config
+
+	// tasks are decoded later
+	globals := struct {
+		*Config
+		Tasks json.RawMessage `json:"tasks"`
+	}{Config: &config}
+	err = json.Unmarshal(data, &globals)
+	if nil != err {
+		problems = append(problems, configProblem{Message: err.Error()})
+	}
+
+	names := make([]string, 0, len(raw.Tasks))
+	for name := range raw.Tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	config.Tasks = make(map[string]*Task, len(raw.Tasks))
+	for _, name := range names {
+		task := newTask()
+		err = json.Unmarshal(raw.Tasks[name], task)
+		if nil != err {
+			problems = append(problems, configProblem{Task: name, Message: err.Error()})
+			continue
+		}
+		task.name = name
+		problems = append(problems, task.validate(strict)...)
+		config.Tasks[name] = task
+	}
+
+	err = checkDependencies(config.Tasks)
+	if nil != err {
+		problems = append(problems, configProblem{Field: "dependsOn", Message: err.Error()})
+	}
+
+	// minisv just logs problems of own limits and http server on start
+	if strict {
+		if err = checkRLimits(config.Limits); nil != err {
+			problems = append(problems, configProblem{Field: "limits", Message: err.Error()})
+		}
+		if err = checkTLS(&config); nil != err {
+			problems = append(problems, configProblem{Field: "http", Message: err.Error()})
+		}
+	}
+
+	return &config, problems
+}
+
+// checkConfig validates config file with all checks and prints problems,
+// returns exit code
+func checkConfig() int {
+	data, err := os.ReadFile(*configfile)
+	if nil != err {
+		fmt.Println("Error reading config file:", err)
+		return 1
+	}
+
+	_, problems := validateConfig(data, true)
+	if len(problems) == 0 {
+		fmt.Println("Config is valid")
+		return 0
+	}
+
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	return 1
+}